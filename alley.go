@@ -0,0 +1,204 @@
+package citygraph
+
+import (
+	"image"
+
+	"github.com/voidshard/citygraph/internal/voronoi"
+)
+
+// maxAlleyPasses is the most times we'll split blocks within a district.
+// Each pass roughly halves our largest blocks so this is plenty.
+const maxAlleyPasses = 8
+
+// addAlleys cuts narrow (1 pixel) alleys through blocks of land that are
+// longer than the district AlleyThreshold, so large blocks don't become solid
+// mats of buildings. Each alley runs straight across the block from road
+// to road.
+// Must be called after endDraw & before buildings are placed.
+func (c *Citygraph) addAlleys() {
+	for _, d := range c.Districts {
+		dcfg, ok := c.bcfg.Districts[d.Type]
+		if !ok || dcfg.AlleyThreshold <= 0 || len(dcfg.Buildings) == 0 {
+			continue
+		}
+		site := c.graph.SiteByID(d.ID)
+		if site == nil {
+			continue
+		}
+
+		failed := map[image.Point]bool{}
+		for pass := 0; pass < maxAlleyPasses; pass++ {
+			cut := false
+			for _, block := range c.blocks(site) {
+				if failed[block[0]] || !tooLong(block, dcfg.AlleyThreshold) {
+					continue
+				}
+				if c.cutBlock(d, block, dcfg.AlleyThreshold) {
+					cut = true
+				} else {
+					failed[block[0]] = true
+				}
+			}
+			if !cut {
+				break
+			}
+		}
+	}
+}
+
+// tooLong returns if the block is longer (in either direction) than threshold
+func tooLong(block []image.Point, threshold int) bool {
+	bnds := pointBounds(block)
+	return bnds.Dx() > threshold || bnds.Dy() > threshold
+}
+
+// pointBounds returns the smallest rectangle holding all the points
+func pointBounds(pnts []image.Point) image.Rectangle {
+	bnds := image.Rectangle{}
+	for i, p := range pnts {
+		r := image.Rect(p.X, p.Y, p.X+1, p.Y+1)
+		if i == 0 {
+			bnds = r
+		} else {
+			bnds = bnds.Union(r)
+		}
+	}
+	return bnds
+}
+
+// blocks returns groups of connected pixels within the site that are free
+// to build on (ie. land without any roads, walls etc). The first point of
+// each group is the same each time we're called (if the group is unchanged).
+func (c *Citygraph) blocks(site voronoi.Site) [][]image.Point {
+	bnds := site.Bounds().Intersect(c.cfg.Area)
+	free := func(p image.Point) bool {
+		return site.Contains(p.X, p.Y) && c.outline.CanBuildOn(p.X, p.Y) && c.cmap.isBlank(p.X, p.Y)
+	}
+
+	seen := make([]bool, bnds.Dx()*bnds.Dy())
+	visit := func(p image.Point) bool {
+		if !p.In(bnds) {
+			return false
+		}
+		i := (p.Y-bnds.Min.Y)*bnds.Dx() + (p.X - bnds.Min.X)
+		if seen[i] || !free(p) {
+			return false
+		}
+		seen[i] = true
+		return true
+	}
+
+	found := [][]image.Point{}
+	for y := bnds.Min.Y; y < bnds.Max.Y; y++ {
+		for x := bnds.Min.X; x < bnds.Max.X; x++ {
+			p := image.Pt(x, y)
+			if !visit(p) {
+				continue
+			}
+
+			block := []image.Point{}
+			queue := []image.Point{p}
+			for len(queue) > 0 {
+				q := queue[0]
+				queue = queue[1:]
+				block = append(block, q)
+				for _, d := range []image.Point{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+					n := q.Add(d)
+					if visit(n) {
+						queue = append(queue, n)
+					}
+				}
+			}
+			found = append(found, block)
+		}
+	}
+
+	return found
+}
+
+// cutBlock cuts an alley across the middle of the block, splitting it's
+// longest side, or failing that the other side (if that too is longer than
+// threshold). Returns if an alley was added.
+func (c *Citygraph) cutBlock(d *District, block []image.Point, threshold int) bool {
+	in := map[image.Point]bool{}
+	for _, p := range block {
+		in[p] = true
+	}
+
+	bnds := pointBounds(block)
+	mid := image.Pt((bnds.Min.X+bnds.Max.X)/2, (bnds.Min.Y+bnds.Max.Y)/2)
+
+	// we step across the block along one side, so the cut splits the other
+	steps := []image.Point{}
+	if bnds.Dx() > threshold {
+		steps = append(steps, image.Pt(0, 1))
+	}
+	if bnds.Dy() > threshold {
+		steps = append(steps, image.Pt(1, 0))
+	}
+	if len(steps) > 1 && bnds.Dy() > bnds.Dx() {
+		steps[0], steps[1] = steps[1], steps[0]
+	}
+
+	for _, step := range steps {
+		run := c.alleyRun(in, mid, step, bnds)
+		if len(run) == 0 {
+			continue
+		}
+
+		for _, p := range run {
+			c.cmap.setAlley(p.X, p.Y)
+		}
+		e := &Edge{Path: [2]image.Point{run[0], run[len(run)-1]}, Sections: []*Section{
+			&Section{Path: [2]image.Point{run[0], run[len(run)-1]}},
+		}}
+		d.Roads = append(d.Roads, e)
+		c.RoadNetwork.add(e, 1, AlleyRoad, d.ID)
+		return true
+	}
+
+	return false
+}
+
+// alleyRun finds the line of block pixels running in the direction of step
+// that passes closest to mid, & where both ends of the line meet a road.
+func (c *Citygraph) alleyRun(in map[image.Point]bool, mid, step image.Point, bnds image.Rectangle) []image.Point {
+	// the axis we slide along to find a line through the block
+	across := image.Pt(step.Y, step.X)
+	span := bnds.Dx()
+	if across.Y != 0 {
+		span = bnds.Dy()
+	}
+
+	for offset := 0; offset <= span/4; offset++ {
+		for _, sign := range []int{1, -1} {
+			start := mid.Add(across.Mul(offset * sign))
+			if !in[start] {
+				continue
+			}
+
+			// walk back to the start of the line, then forward to the end
+			a := start
+			for in[a.Sub(step)] {
+				a = a.Sub(step)
+			}
+			run := []image.Point{a}
+			for p := a.Add(step); in[p]; p = p.Add(step) {
+				run = append(run, p)
+			}
+
+			first, last := run[0].Sub(step), run[len(run)-1].Add(step)
+			if c.isAlleyEnd(first) && c.isAlleyEnd(last) {
+				return run
+			}
+		}
+	}
+
+	return nil
+}
+
+// isAlleyEnd returns if an alley may end at p (ie. it's a road of some kind)
+func (c *Citygraph) isAlleyEnd(p image.Point) bool {
+	cm := c.cmap
+	return cm.IsRoad(p.X, p.Y) || cm.IsBridge(p.X, p.Y) || cm.IsAlley(p.X, p.Y) || cm.IsGatehouse(p.X, p.Y)
+}
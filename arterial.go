@@ -0,0 +1,379 @@
+package citygraph
+
+import (
+	"container/heap"
+	"image"
+	"math"
+
+	"github.com/voidshard/citygraph/internal/line"
+	"github.com/voidshard/citygraph/internal/voronoi"
+)
+
+// edgeGraph is a graph of the voronoi vertices (nodes) & edges that our
+// main roads run along. It's used to plot routes across the city before
+// any roads are drawn.
+type edgeGraph struct {
+	c     *Citygraph
+	nodes []image.Point
+	ids   map[image.Point]int
+	links map[int][]int
+}
+
+// newEdgeGraph builds a graph from all district edges, save those along the
+// border of the city or along walls. Since the city wall can only be crossed
+// at a gate, vertices that are part of the city wall are excluded too.
+func (c *Citygraph) newEdgeGraph() *edgeGraph {
+	g := &edgeGraph{c: c, nodes: []image.Point{}, ids: map[image.Point]int{}, links: map[int][]int{}}
+
+	node := func(p image.Point) int {
+		id, ok := g.ids[p]
+		if !ok {
+			id = len(g.nodes)
+			g.ids[p] = id
+			g.nodes = append(g.nodes, p)
+		}
+		return id
+	}
+
+	seen := map[string]bool{}
+	for _, s := range c.graph.Sites() {
+		for _, e := range s.Edges() {
+			eid := edgeID(e[0], e[1])
+			if seen[eid] || c.wallEdges[eid] || c.wallVerts[e[0]] || c.wallVerts[e[1]] {
+				continue
+			}
+			seen[eid] = true
+			if c.onBorder(e[0]) && c.onBorder(e[1]) {
+				continue
+			}
+			a, b := node(e[0]), node(e[1])
+			g.links[a] = append(g.links[a], b)
+			g.links[b] = append(g.links[b], a)
+		}
+	}
+
+	return g
+}
+
+// nearest returns the node closest to p. If `prefer` is given we pick from
+// those points first (if any of them are nodes).
+func (g *edgeGraph) nearest(p image.Point, prefer []image.Point) (image.Point, bool) {
+	pick := func(candidates []image.Point) (image.Point, bool) {
+		best := -1.0
+		var found image.Point
+		for _, n := range candidates {
+			if _, ok := g.ids[n]; !ok {
+				continue
+			}
+			d := calculateDist(p.X, p.Y, n.X, n.Y)
+			if best < 0 || d < best {
+				best = d
+				found = n
+			}
+		}
+		return found, best >= 0
+	}
+
+	if found, ok := pick(prefer); ok {
+		return found, true
+	}
+	return pick(g.nodes)
+}
+
+// cost returns the cost of a road running along (a,b) or false if we
+// cannot build a road there at all.
+func (g *edgeGraph) cost(a, b image.Point) (float64, bool) {
+	cost := 0.0
+	blocked := 0
+	water := 0
+
+	for _, p := range line.PointsBetween(a, b) {
+		if g.c.outline.CanBridgeOver(p.X, p.Y) {
+			water++
+			if g.c.cfg.MaxBridgeLength > 0 && water > g.c.cfg.MaxBridgeLength {
+				return 0, false
+			}
+			cost += 2
+			continue
+		}
+		water = 0
+
+		if g.c.cmap.isFortification(p.X, p.Y) {
+			cost += 10 // permitted, but we'd rather not hug walls
+		} else if g.c.outline.CanBuildOn(p.X, p.Y) {
+			cost++
+		} else {
+			blocked++
+		}
+	}
+
+	// allow for a little rounding at the ends
+	if blocked > 2 {
+		return 0, false
+	}
+
+	if r := g.c.RoadNetwork.find(a, b); r != nil && r.Hierarchy == ArterialRoad {
+		cost /= 2 // we'd like arterials to share roads where possible
+	}
+
+	return cost, true
+}
+
+// path returns the cheapest set of edges from node a to node b
+func (g *edgeGraph) path(from, to image.Point) ([][2]image.Point, bool) {
+	start, ok := g.ids[from]
+	if !ok {
+		return nil, false
+	}
+	goal, ok := g.ids[to]
+	if !ok {
+		return nil, false
+	}
+
+	costs := map[int]float64{start: 0}
+	parent := map[int]int{}
+	edgeCost := map[[2]int]float64{}
+
+	open := &routeQueue{}
+	heap.Push(open, &routeNode{i: start, f: 0})
+	for open.Len() > 0 {
+		n := heap.Pop(open).(*routeNode)
+		if n.i == goal {
+			break
+		}
+		if n.f > costs[n.i] {
+			continue
+		}
+
+		for _, next := range g.links[n.i] {
+			key := [2]int{n.i, next}
+			ecost, ok := edgeCost[key]
+			if !ok {
+				ec, valid := g.cost(g.nodes[n.i], g.nodes[next])
+				if !valid {
+					ec = math.Inf(1)
+				}
+				ecost = ec
+				edgeCost[key] = ec
+				edgeCost[[2]int{next, n.i}] = ec
+			}
+			if math.IsInf(ecost, 1) {
+				continue
+			}
+
+			total := n.f + ecost
+			current, seen := costs[next]
+			if seen && total >= current {
+				continue
+			}
+			costs[next] = total
+			parent[next] = n.i
+			heap.Push(open, &routeNode{i: next, f: total})
+		}
+	}
+
+	if _, ok := costs[goal]; !ok {
+		return nil, false
+	}
+
+	path := [][2]image.Point{}
+	for i := goal; i != start; i = parent[i] {
+		path = append([][2]image.Point{{g.nodes[parent[i]], g.nodes[i]}}, path...)
+	}
+
+	return path, true
+}
+
+// onBorder returns if p is on (or next to) the edge of the city area
+func (c *Citygraph) onBorder(p image.Point) bool {
+	bnds := c.cfg.Area
+	return p.X <= bnds.Min.X+1 || p.X >= bnds.Max.X-1 || p.Y <= bnds.Min.Y+1 || p.Y >= bnds.Max.Y-1
+}
+
+// nearestVertex returns the vertex of the site closest to p that is not part
+// of the city wall
+func (c *Citygraph) nearestVertex(p image.Point, site voronoi.Site) (image.Point, bool) {
+	best := -1.0
+	var found image.Point
+	for _, v := range site.Vertices() {
+		if c.wallVerts[v] || c.onBorder(v) {
+			continue
+		}
+		d := calculateDist(p.X, p.Y, v.X, v.Y)
+		if best < 0 || d < best {
+			best = d
+			found = v
+		}
+	}
+	return found, best >= 0
+}
+
+// gateApproach returns points just inside & just outside of the gate that a
+// road should run between in order to pass through the gatehouse
+func (c *Citygraph) gateApproach(g *gateLocation) (image.Point, image.Point) {
+	fort := c.cfg.Fortifications
+	depth := float64(maxint(fort.GatehouseArea.Dx(), fort.GatehouseArea.Dy()) + maxint(c.gateTowerArea().Dx(), c.gateTowerArea().Dy())*2)
+
+	mid := image.Pt((g.Edge[0].X+g.Edge[1].X)/2, (g.Edge[0].Y+g.Edge[1].Y)/2)
+	centre := image.Pt((g.Gatehouse.Min.X+g.Gatehouse.Max.X)/2, (g.Gatehouse.Min.Y+g.Gatehouse.Max.Y)/2)
+
+	// the gatehouse is indented into the "In" site so this points inward
+	dx := float64(centre.X - mid.X)
+	dy := float64(centre.Y - mid.Y)
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return centre, centre
+	}
+	dx, dy = dx/length, dy/length
+
+	in := image.Pt(int(math.Round(float64(centre.X)+dx*depth)), int(math.Round(float64(centre.Y)+dy*depth)))
+	out := image.Pt(int(math.Round(float64(mid.X)-dx*depth)), int(math.Round(float64(mid.Y)-dy*depth)))
+
+	return in, out
+}
+
+// addArterialRoads traces major roads from every gate (and all configured
+// entry points) to the centre of the city. Where there are inner rings of
+// wall roads head for the nearest gate of the next ring in, which in turn
+// leads on toward the centre. Roads follow district edges where
+// possible, with short new roads cut from gates / entry points to the nearest
+// district edge.
+func (c *Citygraph) addArterialRoads() {
+	g := c.newEdgeGraph()
+	width := c.cfg.ArterialRoadWidth
+
+	centre, ok := g.nearest(c.cfg.Centre, nil)
+	if !ok {
+		return
+	}
+
+	// the vertices just outside of each gate of each inner ring, so roads
+	// from outer gates can head to the nearest gate of the next ring in
+	outerVerts := map[int][]image.Point{}
+	for _, gate := range c.gateLocs {
+		if gate.ring == 0 {
+			continue
+		}
+		_, out := c.gateApproach(gate)
+		if vout, ok := c.nearestVertex(out, gate.Out); ok {
+			outerVerts[gate.ring] = append(outerVerts[gate.ring], vout)
+		}
+	}
+
+	for _, gate := range c.gateLocs {
+		in, out := c.gateApproach(gate)
+		gc := image.Pt((gate.Gatehouse.Min.X+gate.Gatehouse.Max.X)/2, (gate.Gatehouse.Min.Y+gate.Gatehouse.Max.Y)/2)
+
+		vin, okIn := c.nearestVertex(in, gate.In)
+		vout, okOut := c.nearestVertex(out, gate.Out)
+
+		// we always run a road through the gate, even if there's no vertex for
+		// it to head to (ie. all the vertices are on walls) as it will likely
+		// meet roads running alongside the wall
+		approach := [][2]image.Point{{gc, in}, {gc, out}}
+		if okIn {
+			approach = append(approach, [2]image.Point{in, vin})
+		}
+		if okOut {
+			approach = append(approach, [2]image.Point{out, vout})
+		}
+		c.addRoadPath(approach, width, ArterialRoad)
+
+		// for city gates the centre is inward, for curtain walls it's (probably) outward
+		from, okFrom := vin, okIn
+		if gate.InDist.HasCurtainFortifications {
+			from, okFrom = vout, okOut
+		}
+		if !okFrom {
+			continue
+		}
+
+		// if there is a ring of wall further in, we head for it's nearest gate
+		to := centre
+		if !gate.InDist.HasCurtainFortifications {
+			best := -1.0
+			for _, v := range outerVerts[gate.ring+1] {
+				if _, ok := g.ids[v]; !ok {
+					continue
+				}
+				d := calculateDist(from.X, from.Y, v.X, v.Y)
+				if best < 0 || d < best {
+					best = d
+					to = v
+				}
+			}
+		}
+
+		path, ok := g.path(from, to)
+		if ok {
+			c.addRoadPath(path, width, ArterialRoad)
+		}
+	}
+
+	for _, p := range c.cfg.ArterialEntryPoints {
+		v, ok := g.nearest(p, c.graph.SiteFor(p.X, p.Y).Vertices())
+		if !ok {
+			continue
+		}
+		path, ok := g.path(v, centre)
+		if !ok {
+			continue
+		}
+		c.addRoadPath(append([][2]image.Point{{p, v}}, path...), width, ArterialRoad)
+	}
+}
+
+// addRoadPath draws roads (and bridges if permitted) along each of the given
+// lines & records them in the RoadNetwork. Lines already in the network are
+// not redrawn.
+func (c *Citygraph) addRoadPath(path [][2]image.Point, width int, h RoadHierarchy) []*Road {
+	added := []*Road{}
+	maxBridges := c.cfg.MaxBridges
+
+	for _, edge := range path {
+		if edge[0] == edge[1] || c.RoadNetwork.find(edge[0], edge[1]) != nil {
+			continue
+		}
+
+		roads, bridges, _ := c.lineSegments(edge[0], edge[1], nil)
+		if len(roads)+len(bridges) == 0 {
+			continue
+		}
+
+		e := &Edge{Path: edge, Sections: []*Section{}}
+		for _, p := range roads {
+			c.cmap.drawRoad(p[0], p[1], width/2)
+			e.Sections = append(e.Sections, &Section{Path: p})
+		}
+
+		sortByLength(bridges)
+		for _, p := range bridges {
+			blen := int(calculateDist(p[0].X, p[0].Y, p[1].X, p[1].Y))
+			if c.cfg.MinBridgeLength > blen {
+				continue
+			}
+			if (maxBridges >= 0 && c.bridges >= maxBridges) || (c.cfg.MaxBridgeLength > 0 && blen > c.cfg.MaxBridgeLength) {
+				// we can't bridge this, but perhaps we can cross some other way
+				if sec := c.addCrossing(p, width/2); sec != nil {
+					e.Sections = append(e.Sections, sec)
+				}
+				continue
+			}
+			c.cmap.drawBridge(p[0], p[1], width/2)
+			c.bridges++
+			c.countBridge(p)
+			e.Sections = append(e.Sections, &Section{Path: p, Bridge: true})
+		}
+
+		r := c.RoadNetwork.add(e, width/2, h)
+		for _, id := range c.districtsBeside(edge[0], edge[1], width) {
+			d, ok := c.cellToDist[id]
+			if ok {
+				c.shareRoad(r, d)
+			}
+		}
+		added = append(added, r)
+	}
+
+	return added
+}
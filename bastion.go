@@ -0,0 +1,245 @@
+package citygraph
+
+import (
+	"image"
+	"math"
+)
+
+// WallStyle determines how walls are fortified (see FortificationSettings.Style)
+type WallStyle string
+
+const (
+	TowerWalls   WallStyle = ""        // square towers along the wall (default)
+	BastionWalls WallStyle = "bastion" // angular bastions at the corners of the wall
+)
+
+// Outwork is a fortification (a bastion or ravelin) given as a polygon
+type Outwork struct {
+	// the wall vertex a bastion is built on, or the front of the gate
+	// a ravelin defends
+	At image.Point
+
+	// the outline of the outwork
+	Polygon []image.Point
+}
+
+// bastionSize returns the size of bastions (see FortificationSettings.BastionSize)
+func (c *Citygraph) bastionSize() int {
+	f := c.cfg.Fortifications
+	if f.BastionSize > 0 {
+		return f.BastionSize
+	}
+	tw, th := f.TowerArea.Dx(), f.TowerArea.Dy()
+	if th > tw {
+		tw = th
+	}
+	return tw * 2
+}
+
+// addBastions builds a bastion on each salient (outward pointing) vertex
+// of the given wall, where `inside` holds the IDs of the sites within the
+// wall. Re-entrant vertices are left to the usual towers.
+func (c *Citygraph) addBastions(wall [][2]image.Point, inside map[int]bool) []*Outwork {
+	// the wall may list the same segment twice, so we dedupe as we go
+	seen := map[string]bool{}
+	nbrs := map[image.Point][]image.Point{}
+	order := []image.Point{}
+	for _, seg := range wall {
+		id := edgeID(seg[0], seg[1])
+		if seen[id] || seg[0] == seg[1] {
+			continue
+		}
+		seen[id] = true
+		for i, p := range seg {
+			if _, ok := nbrs[p]; !ok {
+				order = append(order, p)
+			}
+			nbrs[p] = append(nbrs[p], seg[1-i])
+		}
+	}
+
+	size := float64(c.bastionSize())
+	bastions := []*Outwork{}
+	for _, v := range order {
+		if len(nbrs[v]) != 2 {
+			continue // the end of the wall (ie. at the edge of the map)
+		}
+		p, q := nbrs[v][0], nbrs[v][1]
+		u1x, u1y, l1 := unitVector(v, p)
+		u2x, u2y, l2 := unitVector(v, q)
+		bx, by := -(u1x + u2x), -(u1y + u2y)
+		bl := math.Hypot(bx, by)
+		if bl < 0.1 {
+			continue // the wall runs straight on
+		}
+		bx, by = bx/bl, by/bl
+
+		out := image.Pt(v.X+int(math.Round(bx*3)), v.Y+int(math.Round(by*3)))
+		if !out.In(c.cfg.Area) || inside[c.graph.SiteFor(out.X, out.Y).ID()] {
+			continue // re-entrant, or too near the edge of the map
+		}
+
+		if math.Min(l1, l2) < size {
+			continue // too short to hold a bastion, leave it to a tower
+		}
+
+		poly := bastionPolygon(v, u1x, u1y, l1, u2x, u2y, l2, bx, by, size)
+		if !c.outworkFits(poly) {
+			continue
+		}
+		c.cmap.drawPolygon(poly)
+		bastions = append(bastions, &Outwork{At: v, Polygon: poly})
+	}
+
+	return bastions
+}
+
+// bastionPolygon returns the outline of a bastion on vertex v, where u1 & u2
+// are the directions (with lengths l1 & l2) of the walls leaving v & (bx,by)
+// points outward from the vertex. Where the walls are long enough we build a
+// pentagon (with flanks at right angles to the wall) otherwise a triangle.
+// Walls are expected to be at least size/2 long.
+func bastionPolygon(v image.Point, u1x, u1y, l1, u2x, u2y, l2, bx, by, size float64) []image.Point {
+	pt := func(x, y float64) image.Point {
+		return image.Pt(int(math.Round(x)), int(math.Round(y)))
+	}
+	vx, vy := float64(v.X), float64(v.Y)
+
+	if l1 < size*2 || l2 < size*2 {
+		s := math.Min(size, math.Min(l1, l2)/2)
+		return []image.Point{
+			pt(vx+u1x*s, vy+u1y*s),
+			pt(vx+bx*s, vy+by*s),
+			pt(vx+u2x*s, vy+u2y*s),
+		}
+	}
+
+	flank := size / 2
+	n1x, n1y := outwardNormal(u1x, u1y, bx, by)
+	n2x, n2y := outwardNormal(u2x, u2y, bx, by)
+	ax, ay := vx+u1x*size, vy+u1y*size
+	cx, cy := vx+u2x*size, vy+u2y*size
+	return []image.Point{
+		pt(ax, ay),
+		pt(ax+n1x*flank, ay+n1y*flank),
+		pt(vx+bx*(size+flank), vy+by*(size+flank)),
+		pt(cx+n2x*flank, cy+n2y*flank),
+		pt(cx, cy),
+	}
+}
+
+// addRavelin builds a ravelin in front of the gate, outside the wall (and the
+// road running alongside it). The ravelin is a triangle, built in two halves
+// either side of the road out of the gate.
+func (c *Citygraph) addRavelin(g *gateLocation, width int) []*Outwork {
+	f := c.cfg.Fortifications
+	front := image.Pt((g.Left.X+g.Right.X)/2, (g.Left.Y+g.Right.Y)/2)
+	ux, uy, half := unitVector(g.Left, g.Right)
+	if half == 0 {
+		return nil
+	}
+	half /= 2
+
+	// outward is away from the gatehouse, which is set into the wall
+	gc := image.Pt((g.Gatehouse.Min.X+g.Gatehouse.Max.X)/2, (g.Gatehouse.Min.Y+g.Gatehouse.Max.Y)/2)
+	nx, ny := outwardNormal(ux, uy, float64(front.X-gc.X), float64(front.Y-gc.Y))
+
+	tower := maxint(c.gateTowerArea().Dx(), c.gateTowerArea().Dy())
+	if width > tower {
+		tower = width
+	}
+	gap := float64(tower/2 + f.WallBorderRoadWidth + 2)
+
+	size := float64(c.bastionSize())
+	wide := half + size
+	bx, by := float64(front.X)+nx*gap, float64(front.Y)+ny*gap
+	pt := func(x, y float64) image.Point {
+		return image.Pt(int(math.Round(x)), int(math.Round(y)))
+	}
+
+	// the faces of the triangle run from each end of the base to the apex
+	// (as far out from the base as the base is wide), the road cuts through
+	// the middle
+	depth := wide - half
+	ravelin := []*Outwork{}
+	for _, side := range []float64{-1, 1} {
+		poly := []image.Point{
+			pt(bx+ux*side*wide, by+uy*side*wide),
+			pt(bx+ux*side*half, by+uy*side*half),
+			pt(bx+ux*side*half+nx*depth, by+uy*side*half+ny*depth),
+		}
+		if !c.outworkFits(poly) {
+			return nil
+		}
+		ravelin = append(ravelin, &Outwork{At: front, Polygon: poly})
+	}
+
+	for _, r := range ravelin {
+		c.cmap.drawPolygon(r.Polygon)
+	}
+	return ravelin
+}
+
+// outworkFits returns if the polygon is on land (or bridgeable water, as with
+// towers) & clear of other fortifications
+func (c *Citygraph) outworkFits(poly []image.Point) bool {
+	pixels := polygonPixels(poly)
+	if len(pixels) == 0 {
+		return false
+	}
+	for _, p := range pixels {
+		if !p.In(c.cfg.Area) || c.cmap.isDrawnTower(p.X, p.Y) {
+			return false
+		}
+		if !c.outline.CanBuildOn(p.X, p.Y) && !c.outline.CanBridgeOver(p.X, p.Y) {
+			return false
+		}
+	}
+	return true
+}
+
+// unitVector returns the direction from a to b & the distance between them
+func unitVector(a, b image.Point) (float64, float64, float64) {
+	dx, dy := float64(b.X-a.X), float64(b.Y-a.Y)
+	l := math.Hypot(dx, dy)
+	if l == 0 {
+		return 0, 0, 0
+	}
+	return dx / l, dy / l, l
+}
+
+// outwardNormal returns the normal to (ux,uy) on the same side as (ox,oy)
+func outwardNormal(ux, uy, ox, oy float64) (float64, float64) {
+	nx, ny := -uy, ux
+	if nx*ox+ny*oy < 0 {
+		return -nx, -ny
+	}
+	return nx, ny
+}
+
+// polygonPixels returns the pixels whose centres are within the polygon
+func polygonPixels(poly []image.Point) []image.Point {
+	bnds := pointBounds(poly)
+	pixels := []image.Point{}
+	for y := bnds.Min.Y; y < bnds.Max.Y; y++ {
+		for x := bnds.Min.X; x < bnds.Max.X; x++ {
+			if inPolygon(float64(x)+0.5, float64(y)+0.5, poly) {
+				pixels = append(pixels, image.Pt(x, y))
+			}
+		}
+	}
+	return pixels
+}
+
+// inPolygon returns if (x,y) is within the polygon (even-odd rule)
+func inPolygon(x, y float64, poly []image.Point) bool {
+	in := false
+	for i, j := 0, len(poly)-1; i < len(poly); j, i = i, i+1 {
+		ax, ay := float64(poly[i].X), float64(poly[i].Y)
+		bx, by := float64(poly[j].X), float64(poly[j].Y)
+		if (ay > y) != (by > y) && x < (bx-ax)*(y-ay)/(by-ay)+ax {
+			in = !in
+		}
+	}
+	return in
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"image"
 	"io/ioutil"
+	"math"
 	"math/rand"
+	"sort"
 	"time"
 
 	"github.com/voidshard/citygraph/internal/cell"
@@ -28,17 +30,43 @@ type Citygraph struct {
 
 	rng *rand.Rand
 
-	Districts []*District
-	Walls     []*Edge           `json:",omitempty"`
-	Towers    []image.Rectangle `json:",omitempty"`
-	Gates     []image.Rectangle `json:",omitempty"`
-	Stats     *CityStats        `json:",omitempty"`
-	Seed      int64
+	Districts     []*District
+	Walls         []*Edge             `json:",omitempty"`
+	Towers        []image.Rectangle   `json:",omitempty"`
+	Gates         []image.Rectangle   `json:",omitempty"`
+	Bastions      []*Outwork          `json:",omitempty"`
+	Ravelins      []*Outwork          `json:",omitempty"`
+	Moats         [][]image.Point     `json:",omitempty"`
+	GateScores    []*GateScore        `json:",omitempty"`
+	WallRepairs   []*WallRepair       `json:",omitempty"`
+	WallRings     []*WallRing         `json:",omitempty"`
+	WaterDefences []*WaterDefence     `json:",omitempty"`
+	Posterns      []*Postern          `json:",omitempty"`
+	Stairs        []*Stair            `json:",omitempty"`
+	RoadNetwork   *RoadNetwork        `json:",omitempty"`
+	Connectivity  *ConnectivityReport `json:",omitempty"`
+	Plazas        []*Plaza            `json:",omitempty"`
+	Stats         *CityStats          `json:",omitempty"`
+	Footprints    map[int]*Footprint  `json:",omitempty"` // by building ID, see Building.Footprint
+	Seed          int64
 
 	gb         *voronoi.Builder
 	graph      *voronoi.Voronoi
 	cellToDist map[int]*District
 	cmap       *imageMap
+
+	// gatehouses placed in walls, the edges that walls follow & the vertices
+	// of the city wall
+	gateLocs  []*gateLocation
+	wallEdges map[string]bool
+	wallVerts map[image.Point]bool
+
+	// bridges created for city roads (see CityConfig.MaxBridges)
+	bridges int
+
+	// ExternalConnections we couldn't route a road from (see
+	// ConnectivityReport.UnroutedExternal)
+	unroutedExternal []image.Point
 }
 
 // New creates a new Citygraph given configuaration & an Outline
@@ -72,6 +100,39 @@ func (c *Citygraph) Map() CityMap {
 	return c.cmap
 }
 
+// RoadAt returns the road in the RoadNetwork that was drawn at x,y (if any).
+func (c *Citygraph) RoadAt(x, y int) *Road {
+	return c.RoadNetwork.RoadAt(x, y)
+}
+
+// BuildingConfig returns the BuildingConfig with the given ID (see
+// BuildingConfig.ID), from any district or plaza, or nil if there isn't one.
+// Where districts share an ID we return the config of the first district by
+// DistrictType (sorted), so the same config is returned every time.
+func (c *Citygraph) BuildingConfig(id int) *BuildingConfig {
+	types := []DistrictType{}
+	for dt := range c.bcfg.Districts {
+		types = append(types, dt)
+	}
+	sort.Slice(types, func(i, k int) bool { return types[i] < types[k] })
+
+	for _, dt := range types {
+		dcfg := c.bcfg.Districts[dt]
+		if dcfg.Central != nil && dcfg.Central.ID == id {
+			return dcfg.Central
+		}
+		for _, b := range dcfg.Buildings {
+			if b.ID == id {
+				return b
+			}
+		}
+	}
+	if c.cfg.Plazas != nil && c.cfg.Plazas.Feature != nil && c.cfg.Plazas.Feature.ID == id {
+		return c.cfg.Plazas.Feature
+	}
+	return nil
+}
+
 // build runs the main construction logic. Order of the functions
 // is important as later functions rely on things being done / not done
 // to save re-processing stuff.
@@ -93,6 +154,7 @@ func (c *Citygraph) build() error {
 		dist.Type = d.Type
 		dist.HasFortifications = d.HasFortifications
 		dist.HasCurtainFortifications = d.HasCurtainFortifications
+		dist.Tags = copyTags(d.Tags)
 
 		c.Stats.increment(d.Type)
 	}
@@ -112,15 +174,31 @@ func (c *Citygraph) build() error {
 		return err
 	}
 
+	// district types are now settled, so we can add their metadata
+	c.tagDistricts()
+
 	if c.cfg.Fortifications != nil {
 		// if required, place city / district walls
 		err = c.addWalls(added)
 		if err != nil {
 			return err
 		}
+
+		// roads are drawn thicker than the lines we check, so where it matters
+		// forbid them from painting over walls
+		if c.protectsFortifications() {
+			c.cmap.protectFortifications()
+		}
 	}
 
 	// now that all the district locations / types are set, move on to roads
+	if c.cfg.ArterialRoadWidth > 0 {
+		c.addArterialRoads()
+	}
+	if len(c.cfg.ExternalConnections) > 0 {
+		c.unroutedExternal = c.addExternalRoads()
+	}
+
 	err = c.addMainRoads()
 	if err != nil {
 		return err
@@ -131,15 +209,62 @@ func (c *Citygraph) build() error {
 		return err
 	}
 
-	wallroadwidth := 0
+	if c.cfg.Fortifications != nil && c.cfg.Fortifications.WallBorderRoadWidth > 0 {
+		c.addWallSideRoads(c.cfg.Fortifications.WallBorderRoadWidth)
+	}
+	if c.cfg.Fortifications != nil && c.cfg.Fortifications.MaxPosterns > 0 {
+		c.addPosterns()
+	}
+	if c.cfg.Fortifications != nil && c.cfg.Fortifications.MoatWidth > 0 {
+		c.addDrawbridges()
+	}
+
+	c.cmap.endDraw() // tell the map we're done painting things
+
+	// make sure all the roads are connected (where we can)
+	c.Connectivity = c.addConnectors()
+
+	// cut through any overly large blocks
+	c.addAlleys()
+
+	// now that all roads are painted, work out how they connect
+	c.RoadNetwork.link(c.cfg.MainRoadWidth)
+	c.RoadNetwork.buildIndex(c.cmap)
+
 	if c.cfg.Fortifications != nil {
-		wallroadwidth = c.cfg.Fortifications.WallBorderRoadWidth
+		c.addGateRoads()
+	}
+
+	if c.cfg.Plazas != nil {
+		c.addPlazas()
+	}
+
+	// stairs are linked to roads, so go in once roads are finished (and before
+	// buildings, which must keep clear of them)
+	if c.cfg.Fortifications != nil && c.cfg.Fortifications.StairInterval > 0 {
+		c.addStairs()
 	}
-	c.cmap.endDraw(wallroadwidth, c.outline) // tell the map we're done painting things
 
 	err = c.addBuildings()
+	if err != nil {
+		return err
+	}
+	c.Footprints = c.buildingFootprints()
 
-	return err
+	if c.cfg.StreetNamer != nil {
+		c.nameStreets()
+	}
+
+	return nil
+}
+
+// protectsFortifications returns if walls must be kept clear of roads drawn
+// after them. Arterial roads are wide enough to cut clean through a wall,
+// while posterns & stairs are placed against the walls as drawn.
+// Otherwise roads may paint over walls as they always have.
+func (c *Citygraph) protectsFortifications() bool {
+	f := c.cfg.Fortifications
+	return c.cfg.ArterialRoadWidth > 0 || f.MaxPosterns > 0 || f.StairInterval > 0
 }
 
 // addWalls adds all walls (both citywalls & district curtain walls)
@@ -198,8 +323,7 @@ func (c *Citygraph) addWalls(in []*District) error {
 	// work out potential locations of gates for each district
 	gatesIdeal := map[int][]*gateLocation{}
 	gatesOther := map[int][]*gateLocation{}
-	ghWidth := (c.cfg.Fortifications.TowerArea.Max.X-c.cfg.Fortifications.TowerArea.Min.X)*2 + c.cfg.Fortifications.GatehouseArea.Max.X - c.cfg.Fortifications.GatehouseArea.Min.X
-	ghHeight := (c.cfg.Fortifications.TowerArea.Max.Y-c.cfg.Fortifications.TowerArea.Min.Y)*2 + c.cfg.Fortifications.GatehouseArea.Max.Y - c.cfg.Fortifications.GatehouseArea.Min.Y
+	ghWidth, ghHeight := c.gatehouseSize()
 
 	// What we want here is all edges to valid districts that we could
 	// (probably) put a gatehouse in.
@@ -256,13 +380,32 @@ func (c *Citygraph) addWalls(in []*District) error {
 	allTowers := []image.Rectangle{}
 	if len(insideDists) > 0 {
 		gates, _ := gatesIdeal[-1]
-		ws, gs, ts := c.wallDistricts(insideDists, outsideDists, gates, allTowers)
+
+		spec := c.cityWallSpec()
+		if len(insideDists) == 1 {
+			spec = c.curtainWallSpec()
+		}
+		for _, p := range c.cfg.ExternalConnections {
+			p = c.borderPoint(p)
+			spec.toward = append(spec.toward, [2]image.Point{p, p})
+		}
+		ws, gs, ts, bs, rs := c.wallDistricts(insideDists, outsideDists, gates, allTowers, spec)
 		c.Walls = ws
 		c.Towers = ts
+		c.Bastions = bs
+		c.WallRings = rs
 		allTowers = append(allTowers, ts...)
+		made := []*gateLocation{}
 		for _, gate := range gs {
 			c.Gates = append(c.Gates, gate.Gatehouse)
+			c.GateScores = append(c.GateScores, gate.scored())
+			c.Ravelins = append(c.Ravelins, gate.ravelin...)
+			c.gateLocs = append(c.gateLocs, gate)
+			made = append(made, gate)
 		}
+
+		// and any inner rings of wall within the city wall
+		allTowers = c.addRings(insideDists, made, allTowers)
 	}
 
 	for _, d := range curtainWall {
@@ -270,12 +413,17 @@ func (c *Citygraph) addWalls(in []*District) error {
 		if !ok || len(gates) == 0 { // probably we aren't within the city proper
 			gates, _ = gatesOther[d.ID]
 		}
-		ws, gs, ts := c.wallDistricts([]*District{d}, nil, gates, allTowers)
+		ws, gs, ts, bs, rs := c.wallDistricts([]*District{d}, nil, gates, allTowers, c.curtainWallSpec())
 		d.Walls = ws
 		d.Towers = ts
+		d.Bastions = bs
+		d.WallRings = rs
 		allTowers = append(allTowers, ts...)
 		for _, gate := range gs {
 			d.Gates = append(d.Gates, gate.Gatehouse)
+			d.Ravelins = append(d.Ravelins, gate.ravelin...)
+			c.GateScores = append(c.GateScores, gate.scored())
+			c.gateLocs = append(c.gateLocs, gate)
 		}
 
 	}
@@ -283,38 +431,57 @@ func (c *Citygraph) addWalls(in []*District) error {
 	return nil
 }
 
-// wallDistricts builds walls / towers / gates around the given `in` district(s)
-func (c *Citygraph) wallDistricts(in, out []*District, gates []*gateLocation, allTowers []image.Rectangle) ([]*Edge, map[string]*gateLocation, []image.Rectangle) {
+// wallDistricts builds walls / towers / gates (and bastions, if the wall Style
+// calls for them) around the given `in` district(s). We also return the wall
+// as ordered ring(s), see WallRing.
+func (c *Citygraph) wallDistricts(in, out []*District, gates []*gateLocation, allTowers []image.Rectangle, spec wallSpec) ([]*Edge, map[string]*gateLocation, []image.Rectangle, []*Outwork, []*WallRing) {
 	towers := []image.Rectangle{}
 	madeGates := map[string]*gateLocation{}
+	bastions := []*Outwork{}
+	bastionAt := map[image.Point]bool{}
+	bastionStyle := c.cfg.Fortifications.Style == BastionWalls
 
-	tryPlaceTower := func(p image.Point, mdbt int) {
-		tower, ok := c.towerFits(p.X, p.Y)
+	tryPlaceTower := func(p image.Point, mdbt int, area image.Rectangle) bool {
+		tower, ok := c.towerFits(p.X, p.Y, area)
 		if !ok {
-			return
+			return false
 		}
 		if mdbt > 0 {
 			for _, t := range append(allTowers, towers...) {
 				tx, ty := (t.Max.X+t.Min.X)/2, (t.Max.Y+t.Min.Y)/2
 				if int(calculateDist(tx, ty, p.X, p.Y)) < mdbt {
-					return
+					return false
+				}
+			}
+			for _, b := range bastions {
+				if int(calculateDist(b.At.X, b.At.Y, p.X, p.Y)) < mdbt {
+					return false
 				}
 			}
 		}
 		c.cmap.drawTower(tower.Min, tower.Max.X-tower.Min.X, tower.Max.Y-tower.Min.Y)
 		towers = append(towers, tower)
+		return true
 	}
 
 	fillWithTowers := func(a, b image.Point) {
-		mdbt := c.cfg.Fortifications.MinDistBetweenTowers
+		mdbt := spec.towerGap
 
-		// firstly, place at both ends
-		tryPlaceTower(a, mdbt/2)
-		tryPlaceTower(b, mdbt/2)
+		// firstly, place at both ends (unless there's a bastion there)
+		ends := mdbt / 2
+		if c.cfg.RoadMode != DiagonalRoads {
+			ends = mdbt // walls are broken into many short sections
+		}
+		if !bastionAt[a] {
+			tryPlaceTower(a, ends, c.cfg.Fortifications.TowerArea)
+		}
+		if !bastionAt[b] {
+			tryPlaceTower(b, ends, c.cfg.Fortifications.TowerArea)
+		}
 
 		pnts := line.PointsBetween(a, b)
 		for i := mdbt; i < len(pnts); i += mdbt {
-			tryPlaceTower(pnts[i], mdbt)
+			tryPlaceTower(pnts[i], mdbt, c.cfg.Fortifications.TowerArea)
 		}
 	}
 
@@ -327,12 +494,11 @@ func (c *Citygraph) wallDistricts(in, out []*District, gates []*gateLocation, al
 		return fmt.Sprintf("%d,%d-%d,%d", a.X, a.Y, b.X, b.Y)
 	}
 
-	width := c.cfg.Fortifications.WallWidth
-	maxGates := c.cfg.Fortifications.MaxCityGates
+	width := spec.width
+	maxGates := spec.maxGates
 	if len(in) == 0 {
-		return []*Edge{}, madeGates, towers // ??
+		return []*Edge{}, madeGates, towers, bastions, []*WallRing{} // ??
 	} else if len(in) == 1 {
-		maxGates = 1 // since we're walling a single district
 		out = []*District{}
 		for _, d := range c.Districts {
 			if d.ID == in[0].ID {
@@ -340,7 +506,6 @@ func (c *Citygraph) wallDistricts(in, out []*District, gates []*gateLocation, al
 			}
 			out = append(out, d)
 		}
-		width = c.cfg.Fortifications.CurtainWallWidth
 	}
 
 	inside := []voronoi.Site{}
@@ -353,12 +518,21 @@ func (c *Citygraph) wallDistricts(in, out []*District, gates []*gateLocation, al
 		outside = append(outside, c.graph.SiteByID(d.ID))
 	}
 
-	for _, loc := range gates {
-		if len(madeGates) >= maxGates {
+	wall := cell.Circut(c.cfg.Area, inside, outside)
+	isInside := map[int]bool{}
+	for _, site := range inside {
+		isInside[site.ID()] = true
+	}
+
+	// we take the best scoring gate locations, in light of those we've placed
+	scorer := c.newGateScorer(gates, wall, isInside, spec)
+	for len(madeGates) < maxGates {
+		loc := scorer.next()
+		if loc == nil {
 			break
 		}
 		// figure out where we'd like to put towers / gatehouse
-		err := loc.determinePlacements(c.graph, c.cfg.Fortifications.TowerArea, c.cfg.Fortifications.GatehouseArea)
+		err := loc.determinePlacements(c.graph, c.gateTowerArea(), c.cfg.Fortifications.GatehouseArea)
 		if err != nil {
 			continue
 		}
@@ -369,6 +543,7 @@ func (c *Citygraph) wallDistricts(in, out []*District, gates []*gateLocation, al
 		}
 
 		madeGates[toEdgeID(loc.Edge[0], loc.Edge[1])] = loc
+		scorer.choose(loc)
 
 		for _, wall := range loc.Walls {
 			c.cmap.drawWall(wall[0], wall[1], width)
@@ -381,8 +556,44 @@ func (c *Citygraph) wallDistricts(in, out []*District, gates []*gateLocation, al
 	}
 
 	edges := []*Edge{}
-	wall := cell.Circut(c.cfg.Area, inside, outside)
+	crossings := [][2]image.Point{} // stretches of water too long to wall over
+
+	if bastionStyle {
+		bastions = c.addBastions(wall, isInside)
+		for _, b := range bastions {
+			bastionAt[b.At] = true
+		}
+		if c.cfg.Fortifications.Ravelins {
+			for _, loc := range scorer.chosen {
+				loc.ravelin = c.addRavelin(loc, width)
+			}
+		}
+	}
+
+	// towers on sharp corners come first, so they aren't crowded out by
+	// towers along the wall
+	cornerArea := c.cornerTowerArea()
+	cornerSize := maxint(cornerArea.Dx(), cornerArea.Dy())
+	for _, corner := range c.wallCorners(wall) {
+		if bastionAt[corner.at] || towerNear(corner.at, cornerSize/2, append(allTowers, towers...)) || nearGate(madeGates, corner.at, cornerSize) {
+			continue
+		}
+		for _, p := range corner.candidates(cornerSize) {
+			if tryPlaceTower(p, 0, cornerArea) {
+				break
+			}
+		}
+	}
+
 	for _, segment := range wall {
+		c.wallEdges[edgeID(segment[0], segment[1])] = true
+		if len(in) > 1 {
+			// passing through a vertex of the city wall means going from inside to
+			// outside, whereas we can go around the corner of a curtain wall
+			c.wallVerts[segment[0]] = true
+			c.wallVerts[segment[1]] = true
+		}
+
 		land, water, walls := c.lineSegments(segment[0], segment[1], nil)
 		if len(land)+len(water) == 0 {
 			continue
@@ -396,7 +607,9 @@ func (c *Citygraph) wallDistricts(in, out []*District, gates []*gateLocation, al
 				// we've already drawn the walls, we just need to add the edges
 				// to our metadata
 				for _, gatehouseWall := range gate.Walls {
-					e.Sections = append(e.Sections, &Section{Path: gatehouseWall})
+					for _, p := range orthogonalise(gatehouseWall[0], gatehouseWall[1], c.cfg.RoadMode) {
+						e.Sections = append(e.Sections, &Section{Path: p})
+					}
 				}
 				continue
 			}
@@ -408,6 +621,7 @@ func (c *Citygraph) wallDistricts(in, out []*District, gates []*gateLocation, al
 		for _, path := range water {
 			dist := int(calculateDist(path[0].X, path[0].Y, path[1].X, path[1].Y))
 			if c.cfg.Fortifications.MaxBridgeWallLength > 0 && dist > c.cfg.Fortifications.MaxBridgeWallLength {
+				crossings = append(crossings, path)
 				continue
 			}
 			c.cmap.drawWall(path[0], path[1], width)
@@ -419,22 +633,70 @@ func (c *Citygraph) wallDistricts(in, out []*District, gates []*gateLocation, al
 		edges = append(edges, e)
 	}
 
-	return edges, madeGates, towers
+	// close off the water we didn't wall over (see WaterCrossing)
+	placeTower := func(p image.Point, area image.Rectangle) *image.Rectangle {
+		if tryPlaceTower(p, 0, area) {
+			t := towers[len(towers)-1]
+			return &t
+		}
+		// there's often a tower here already, at the end of the wall
+		for _, placed := range [][]image.Rectangle{towers, allTowers} {
+			for _, t := range placed {
+				if p.In(t.Inset(-1)) {
+					return &t
+				}
+			}
+		}
+		return nil
+	}
+	fillTowers := func(a, b image.Point) []image.Rectangle {
+		placed := len(towers)
+		fillWithTowers(a, b)
+		return append([]image.Rectangle{}, towers[placed:]...)
+	}
+	water := c.waterCrossings(crossings, width+c.largestTowerSize())
+	c.WaterDefences = append(c.WaterDefences, c.defendWater(water, isInside, width, placeTower, fillTowers)...)
+
+	// close any gaps left in the wall (ie. where edges don't quite line up)
+	for _, gap := range c.wallGaps(edges, madeGates, width) {
+		c.cmap.drawWall(gap.path[0], gap.path[1], width)
+		if gap.edge != nil {
+			gap.edge.Sections = append(gap.edge.Sections, &Section{Path: gap.path})
+		} else {
+			edges = append(edges, &Edge{Path: gap.path, Sections: []*Section{&Section{Path: gap.path}}})
+			wall = append(wall, gap.path)
+		}
+
+		repair := &WallRepair{Path: gap.path}
+		if gap.vertex != nil && !bastionAt[*gap.vertex] {
+			if tryPlaceTower(*gap.vertex, spec.towerGap/2, cornerArea) {
+				tower := towers[len(towers)-1]
+				repair.Tower = &tower
+			}
+		}
+		c.WallRepairs = append(c.WallRepairs, repair)
+	}
+
+	if spec.moat > 0 {
+		c.Moats = append(c.Moats, c.addMoat(wall, isInside, madeGates, width, spec.moat)...)
+	}
+
+	return edges, madeGates, towers, bastions, wallRings(wall, in, towers, madeGates, spec.ring)
 }
 
 // towerFits is a somewhat unique building Fit func that
 // - allows a tower to sit atop a wall (makes sense)
 // - allows a tower to be built in "bridgeable" pixels (ie, in water)
-func (c *Citygraph) towerFits(px, py int) (image.Rectangle, bool) {
+// where the tower has the dimensions of twr
+func (c *Citygraph) towerFits(px, py int, twr image.Rectangle) (image.Rectangle, bool) {
 	// px,py is assumed to be the centre of the tower
-	twr := c.cfg.Fortifications.TowerArea
 	tw := twr.Max.X - twr.Min.X
 	th := twr.Max.Y - twr.Min.Y
 	area := image.Rect(px-tw/2, py-th/2, px+tw/2, py+th/2)
 	for x := area.Min.X; x < area.Max.X; x++ {
 		for y := area.Min.Y; y < area.Max.Y; y++ {
 			// nb. we allow building over walls & in water ("bridgeable")
-			if c.cmap.IsTower(x, y) || c.cmap.IsGatehouse(x, y) {
+			if c.cmap.isDrawnTower(x, y) {
 				return area, false
 			}
 			if c.outline.CanBuildOn(x, y) || c.outline.CanBridgeOver(x, y) {
@@ -517,55 +779,15 @@ func (c *Citygraph) addBuildingsToDistrict(d *District, dcfg *DistrictConfig, si
 		return nil
 	}
 
-	// to make things look a little bit more natural we'll place buildings via running around
-	// the outside of the region in rings, spiralling inwards towards the centre.
-	// This makes buildings appear to hug the edges / roads a lot more
-	dx := bnds.Max.X - bnds.Min.X
-	dy := bnds.Max.Y - bnds.Min.Y
-	ilimit := dx
-	if dy < dx {
-		ilimit = dy
-	}
-	for i := 0; i < ilimit/2; i++ { // spiral inward by i going along four edges
-		for x := bnds.Min.X + i; x < bnds.Max.X-i; x++ {
-			if c.rng.Float64() < dcfg.BuildingDensity {
-				b := distbuild.chooseBuilding(x, bnds.Min.Y+i)
-				c.cmap.setBuilding(x, bnds.Min.Y+i, b)
-				d.addBuilding(x, bnds.Min.Y+i, b)
-			}
-			if dcfg.MaxBuildings > 0 && len(d.Buildings) >= dcfg.MaxBuildings {
-				return nil
-			}
-			if c.rng.Float64() < dcfg.BuildingDensity {
-				b := distbuild.chooseBuilding(x, bnds.Max.Y-i)
-				c.cmap.setBuilding(x, bnds.Max.Y-1-i, b)
-				d.addBuilding(x, bnds.Max.Y-1-i, b)
-			}
-			if dcfg.MaxBuildings > 0 && len(d.Buildings) >= dcfg.MaxBuildings {
-				return nil
-			}
-		}
-
-		for y := bnds.Min.Y + i; y < bnds.Max.Y-i; y++ {
-			if c.rng.Float64() < dcfg.BuildingDensity {
-				b := distbuild.chooseBuilding(bnds.Min.X+i, y)
-				c.cmap.setBuilding(bnds.Min.X+i, y, b)
-				d.addBuilding(bnds.Min.X+i, y, b)
-			}
-			if dcfg.MaxBuildings > 0 && len(d.Buildings) >= dcfg.MaxBuildings {
-				return nil
-			}
-			if c.rng.Float64() < dcfg.BuildingDensity {
-				b := distbuild.chooseBuilding(bnds.Max.X-i, y)
-				c.cmap.setBuilding(bnds.Max.X-1-i, y, b)
-				d.addBuilding(bnds.Max.X-1-i, y, b)
-			}
-			if dcfg.MaxBuildings > 0 && len(d.Buildings) >= dcfg.MaxBuildings {
-				return nil
-			}
-		}
+	if dcfg.MaxBuildings > 0 && len(d.Buildings) >= dcfg.MaxBuildings {
+		return nil
+	}
 
+	strategy := dcfg.Placement
+	if strategy == nil {
+		strategy = &SpiralPlacement{}
 	}
+	strategy.PlaceBuildings(newDistrictPlacer(distbuild, c.cmap), c.rng)
 
 	return nil
 }
@@ -630,11 +852,16 @@ func (c *Citygraph) addMinorRoads() error {
 		}
 
 		maxBridges := dcfg.MaxBridges
+		built := 0 // bridges on this district's minor roads
 
 		// annnd finally, draw the roads
 		vv := vb.Voronoi()
 		for _, block := range vv.Sites() {
 			for _, edge := range block.Edges() {
+				if c.RoadNetwork.find(edge[0], edge[1]) != nil {
+					continue // the neighbouring block has already added this road
+				}
+
 				roads, bridges, _ := c.lineSegments(edge[0], edge[1], site)
 				if len(roads)+len(bridges) == 0 {
 					continue
@@ -643,35 +870,45 @@ func (c *Citygraph) addMinorRoads() error {
 				e := &Edge{Path: edge, Sections: []*Section{}}
 
 				for _, path := range roads {
-					if path[0].Y == path[1].Y || path[0].X == path[1].X {
+					// nb. in other RoadModes every section is axis aligned, so we
+					// skip roads only if the edge itself is
+					if isAxisAligned(path) && (c.cfg.RoadMode == DiagonalRoads || isAxisAligned(edge)) {
 						continue
 					}
 					if dcfg.RoadWidth < 2 {
 						dcfg.RoadWidth = 2
 					}
-					c.cmap.drawRoad(path[0], path[1], dcfg.RoadWidth/2)
-					e.Sections = append(e.Sections, &Section{Path: path})
+					sec := &Section{Path: path, Curve: c.curve(path[0], path[1], dcfg.RoadWiggle, site)}
+					if sec.Curve == nil {
+						c.cmap.drawRoad(path[0], path[1], dcfg.RoadWidth/2)
+					} else {
+						c.cmap.drawRoadCurve(sec.Curve, dcfg.RoadWidth/2)
+					}
+					e.Sections = append(e.Sections, sec)
 				}
 
 				sortByLength(bridges) // make shortest bridges first
 				for _, path := range bridges {
-					if maxBridges >= 0 && d.Stats.Bridges >= maxBridges {
-						break
-					}
 					blen := int(calculateDist(path[0].X, path[0].Y, path[1].X, path[1].Y))
-					if c.cfg.MaxBridgeLength > 0 && blen > c.cfg.MaxBridgeLength {
+					if c.cfg.MinBridgeLength > blen {
 						continue
 					}
-					if c.cfg.MinBridgeLength > blen {
+					if (maxBridges >= 0 && built >= maxBridges) || (c.cfg.MaxBridgeLength > 0 && blen > c.cfg.MaxBridgeLength) {
+						// we can't bridge this, but perhaps we can cross some other way
+						if sec := c.addCrossing(path, dcfg.RoadWidth/2); sec != nil {
+							e.Sections = append(e.Sections, sec)
+						}
 						continue
 					}
 
 					c.cmap.drawBridge(path[0], path[1], dcfg.RoadWidth/2)
-					d.Stats.Bridges++
+					built++
+					c.countBridge(path)
 					e.Sections = append(e.Sections, &Section{Path: path, Bridge: true})
 				}
 
 				d.Roads = append(d.Roads, e)
+				c.RoadNetwork.add(e, dcfg.RoadWidth/2, MinorRoad, d.ID)
 			}
 		}
 	}
@@ -681,6 +918,8 @@ func (c *Citygraph) addMinorRoads() error {
 
 // lineSegments breaks up points between (start, end) into sections of road(s) and/or bridge(s).
 // If a site is given, we check that all points are within the site.
+// If CityConfig.RoadMode is set the points follow the orthogonal path between (start, end)
+// & every section returned is axis aligned.
 // We return the segment broken into shorter segments where all pixels share some type.
 // - roads: where the pixels are buildable & nothing yet exists
 // - bridges: where the pixels are bridgeable
@@ -689,7 +928,13 @@ func (c *Citygraph) lineSegments(start, end image.Point, site voronoi.Site) ([][
 	roads := [][2]image.Point{}
 	bridges := [][2]image.Point{}
 	walls := [][2]image.Point{}
+
 	path := line.PointsBetween(start, end)
+	corners := map[int]bool{}
+	if c.cfg.RoadMode != DiagonalRoads {
+		// we break sections at corners so that each is axis aligned
+		path, corners = orthogonalPoints(orthogonalise(start, end, c.cfg.RoadMode))
+	}
 
 	prevIndex := -1
 	prevEnum := -1
@@ -711,6 +956,8 @@ func (c *Citygraph) lineSegments(start, end image.Point, site voronoi.Site) ([][
 			// no putting roads through building(s)
 		} else if c.cmap.isFortification(p.X, p.Y) {
 			me = enumWall
+		} else if c.cmap.isProtected(p.X, p.Y) {
+			// ie. a moat, which we can't draw on
 		} else if c.outline.CanBuildOn(p.X, p.Y) {
 			me = enumRoad
 		} else if c.outline.CanBridgeOver(p.X, p.Y) {
@@ -722,7 +969,7 @@ func (c *Citygraph) lineSegments(start, end image.Point, site voronoi.Site) ([][
 			prevEnum = me
 			continue
 		}
-		if prevEnum == me {
+		if prevEnum == me && !corners[i] {
 			continue
 		}
 
@@ -761,7 +1008,6 @@ func (c *Citygraph) addMainRoads() error {
 	maxY := c.cfg.Area.Max.Y
 
 	width := c.cfg.MainRoadWidth
-	createdBridges := 0
 	maxBridges := c.cfg.MaxBridges
 
 	for _, d := range c.Districts {
@@ -789,6 +1035,12 @@ func (c *Citygraph) addMainRoads() error {
 				continue
 			}
 
+			if r := c.RoadNetwork.find(edge[0], edge[1]); r != nil {
+				// the neighbouring district (or an arterial) has already drawn this road
+				c.shareRoad(r, d)
+				continue
+			}
+
 			roads, bridges, _ := c.lineSegments(edge[0], edge[1], nil)
 			if len(roads)+len(bridges) == 0 {
 				continue
@@ -797,34 +1049,198 @@ func (c *Citygraph) addMainRoads() error {
 			e := &Edge{Path: edge, Sections: []*Section{}}
 
 			for _, path := range roads {
-				c.cmap.drawRoad(path[0], path[1], width/2)
-				e.Sections = append(e.Sections, &Section{Path: path})
+				sec := &Section{Path: path, Curve: c.curve(path[0], path[1], c.cfg.MainRoadWiggle, nil)}
+				if sec.Curve == nil {
+					c.cmap.drawRoad(path[0], path[1], width/2)
+				} else {
+					c.cmap.drawRoadCurve(sec.Curve, width/2)
+				}
+				e.Sections = append(e.Sections, sec)
 			}
 
 			sortByLength(bridges) // make shortest first (seems logical)
 
 			for _, path := range bridges {
-				if maxBridges >= 0 && createdBridges >= maxBridges {
-					break
-				}
 				blen := int(calculateDist(path[0].X, path[0].Y, path[1].X, path[1].Y))
-				if c.cfg.MaxBridgeLength > 0 && blen > c.cfg.MaxBridgeLength {
+				if c.cfg.MinBridgeLength > blen {
 					continue
 				}
-				if c.cfg.MinBridgeLength > blen {
+				if (maxBridges >= 0 && c.bridges >= maxBridges) || (c.cfg.MaxBridgeLength > 0 && blen > c.cfg.MaxBridgeLength) {
+					// we can't bridge this, but perhaps we can cross some other way
+					if sec := c.addCrossing(path, width/2); sec != nil {
+						e.Sections = append(e.Sections, sec)
+					}
 					continue
 				}
 				c.cmap.drawBridge(path[0], path[1], width/2)
-				createdBridges++
+				c.bridges++
+				c.countBridge(path)
 				e.Sections = append(e.Sections, &Section{Path: path, Bridge: true})
 			}
 
 			d.Roads = append(d.Roads, e)
+			c.RoadNetwork.add(e, width/2, MainRoad, d.ID)
 		}
 	}
 	return nil
 }
 
+// shareRoad lists the road r as one of the roads of district d (if it isn't already)
+func (c *Citygraph) shareRoad(r *Road, d *District) {
+	for _, id := range r.Districts {
+		if id == d.ID {
+			return
+		}
+	}
+	r.addDistrict(d.ID)
+	d.Roads = append(d.Roads, r.Edge)
+}
+
+// countBridge counts a (road) bridge along path towards the DistrictStats of
+// the district that the middle of the bridge is in. This is separate to the
+// bridge limits (see CityConfig.MaxBridges & DistrictConfig.MaxBridges).
+func (c *Citygraph) countBridge(path [2]image.Point) {
+	mid := image.Pt((path[0].X+path[1].X)/2, (path[0].Y+path[1].Y)/2)
+	if d, ok := c.cellToDist[c.graph.SiteFor(mid.X, mid.Y).ID()]; ok {
+		d.Stats.Bridges++
+	}
+}
+
+// addWallSideRoads adds roads running alongside walls / towers, one either
+// side of each wall, offset far enough that they clear any towers (and any
+// moat). These are subject to the same bridge limits as main roads & like
+// other roads are drawn half the configured width.
+func (c *Citygraph) addWallSideRoads(roadWidth int) {
+	width := maxint(1, roadWidth/2)
+	towerSize := c.largestTowerSize()
+	maxBridges := c.cfg.MaxBridges
+
+	add := func(walls []*Edge, wallWidth int) {
+		offset := maxint(wallWidth, towerSize)/2 + width/2 + 1
+		for _, wall := range walls {
+			for _, side := range []int{-1, 1} {
+				dist := offset
+				if moat := c.cfg.Fortifications.MoatWidth; moat > 0 && c.moatBeside(wall.Path[0], wall.Path[1], side*(wallWidth/2+moat)) {
+					dist = maxint(offset, wallWidth/2+moat+width/2+1)
+				}
+				a, b, ok := c.offsetLine(wall.Path[0], wall.Path[1], side*dist)
+				if !ok {
+					continue
+				}
+
+				roads, bridges, _ := c.lineSegments(a, b, nil)
+				if len(roads)+len(bridges) == 0 {
+					continue
+				}
+
+				e := &Edge{Path: [2]image.Point{a, b}, Sections: []*Section{}}
+				for _, path := range roads {
+					c.cmap.drawRoad(path[0], path[1], width)
+					e.Sections = append(e.Sections, &Section{Path: path})
+				}
+
+				sortByLength(bridges)
+				for _, path := range bridges {
+					blen := int(calculateDist(path[0].X, path[0].Y, path[1].X, path[1].Y))
+					if c.cfg.MinBridgeLength > blen {
+						continue
+					}
+					if (maxBridges >= 0 && c.bridges >= maxBridges) || (c.cfg.MaxBridgeLength > 0 && blen > c.cfg.MaxBridgeLength) {
+						if sec := c.addCrossing(path, width); sec != nil {
+							e.Sections = append(e.Sections, sec)
+						}
+						continue
+					}
+					c.cmap.drawBridge(path[0], path[1], width)
+					c.bridges++
+					c.countBridge(path)
+					e.Sections = append(e.Sections, &Section{Path: path, Bridge: true})
+				}
+
+				r := c.RoadNetwork.add(e, width, WallSideRoad)
+				mid := image.Pt((a.X+b.X)/2, (a.Y+b.Y)/2)
+				if d, ok := c.cellToDist[c.graph.SiteFor(mid.X, mid.Y).ID()]; ok {
+					c.shareRoad(r, d)
+				}
+			}
+		}
+	}
+
+	add(c.Walls, c.cfg.Fortifications.WallWidth)
+	for _, d := range c.Districts {
+		add(d.Walls, c.cfg.Fortifications.CurtainWallWidth)
+	}
+}
+
+// offsetLine returns the line (a,b) moved `dist` pixels to one side (the
+// sign of dist picks the side) & extended by dist at both ends, so that
+// lines offset from neighbouring edges meet at corners. The line is
+// clipped to the city Area; we return false if nothing of it remains.
+func (c *Citygraph) offsetLine(a, b image.Point, dist int) (image.Point, image.Point, bool) {
+	dx := float64(b.X - a.X)
+	dy := float64(b.Y - a.Y)
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return a, b, false
+	}
+
+	tx, ty := dx/length, dy/length // unit vector along the line
+	nx, ny := -ty, tx              // & perpendicular to it
+	d := float64(dist)
+	ext := math.Abs(d)
+
+	oa := image.Pt(
+		int(math.Round(float64(a.X)+nx*d-tx*ext)),
+		int(math.Round(float64(a.Y)+ny*d-ty*ext)),
+	)
+	ob := image.Pt(
+		int(math.Round(float64(b.X)+nx*d+tx*ext)),
+		int(math.Round(float64(b.Y)+ny*d+ty*ext)),
+	)
+
+	pnts := line.PointsBetween(oa, ob)
+	first, last := -1, -1
+	for i, p := range pnts {
+		if !p.In(c.cfg.Area) {
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		last = i
+	}
+	if first < 0 || first == last {
+		return a, b, false
+	}
+	return pnts[first], pnts[last], true
+}
+
+// districtsBeside returns the IDs of the districts found `dist` pixels either
+// side of the middle of the line (a,b)
+func (c *Citygraph) districtsBeside(a, b image.Point, dist int) []int {
+	dx := float64(b.X - a.X)
+	dy := float64(b.Y - a.Y)
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return []int{c.graph.SiteFor(a.X, a.Y).ID()}
+	}
+
+	// unit vector perpendicular to the line
+	nx, ny := -dy/length, dx/length
+	mx, my := float64(a.X+b.X)/2, float64(a.Y+b.Y)/2
+
+	ids := []int{}
+	for _, side := range []float64{-1, 1} {
+		x := int(math.Round(mx + side*nx*float64(dist)))
+		y := int(math.Round(my + side*ny*float64(dist)))
+		id := c.graph.SiteFor(x, y).ID()
+		if len(ids) == 0 || ids[0] != id {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
 // verifyDistrictLocations - we do our best in randomDistricts() to pick sensible locations
 // but we have to have chosen all sites in order for us to count their Buildable/DockSuitable
 // co-ords. Because of this we have to run through them all & do some last minute
@@ -1074,6 +1490,22 @@ func (c *Citygraph) chooseDistrictType(total float64) DistrictType {
 	return Empty
 }
 
+// tagDistricts copies the DistrictConfig.Tags on to each district, bar any
+// already set by the district's DistrictSite
+func (c *Citygraph) tagDistricts() {
+	for _, d := range c.Districts {
+		dcfg, ok := c.bcfg.Districts[d.Type]
+		if !ok || len(dcfg.Tags) == 0 {
+			continue
+		}
+		tags := copyTags(dcfg.Tags)
+		for k, v := range d.Tags {
+			tags[k] = v
+		}
+		d.Tags = tags
+	}
+}
+
 // newDistrict builds a new district struct & wires it in.
 // Nb. we don't set district type here so don't increment city stats
 func (c *Citygraph) newDistrict(id int) *District {
@@ -1101,6 +1533,7 @@ func (c *Citygraph) init() error {
 	c.Seed = c.cfg.Seed
 	c.rng = rand.New(rand.NewSource(c.cfg.Seed))
 	c.cmap = newMap(c.cfg.Area)
+	c.cmap.mode = c.cfg.RoadMode
 
 	if c.cfg.MainRoadWidth < 1 {
 		c.cfg.MainRoadWidth = 1
@@ -1120,6 +1553,20 @@ func (c *Citygraph) init() error {
 	c.Walls = []*Edge{}
 	c.Gates = []image.Rectangle{}
 	c.Towers = []image.Rectangle{}
+	c.Bastions = []*Outwork{}
+	c.Ravelins = []*Outwork{}
+	c.Moats = [][]image.Point{}
+	c.GateScores = []*GateScore{}
+	c.WallRepairs = []*WallRepair{}
+	c.WallRings = []*WallRing{}
+	c.WaterDefences = []*WaterDefence{}
+	c.Posterns = []*Postern{}
+	c.Stairs = []*Stair{}
+	c.RoadNetwork = newRoadNetwork(c.cfg.Area)
+	c.Plazas = []*Plaza{}
+	c.gateLocs = []*gateLocation{}
+	c.wallEdges = map[string]bool{}
+	c.wallVerts = map[image.Point]bool{}
 
 	c.gb = voronoi.NewBuilder(c.cfg.Area)
 	c.gb.SetSeed(c.cfg.Seed)
@@ -7,6 +7,7 @@ import (
 	"image/draw"
 
 	"github.com/voidshard/citygraph/internal/encoding"
+	"github.com/voidshard/citygraph/internal/line"
 
 	"github.com/boljen/go-bitmap"
 	"github.com/fogleman/gg"
@@ -20,6 +21,21 @@ const (
 	bitWall   = 2
 	bitTower  = 3
 	bitGate   = 4
+	bitAlley  = 5
+)
+
+// feature is a flag in our feature plane (see imageMap.features). Each
+// feature has it's own bit, so a pixel can be any number of them at once.
+type feature uint16
+
+const (
+	featureFord feature = 1 << iota
+	featureFerry
+	featurePlaza
+	featureMoat
+	featureChain
+	featurePostern
+	featureStairs
 )
 
 // CityMap is a graphical representation of a CityGraph
@@ -39,6 +55,17 @@ type CityMap interface {
 	IsWall(x, y int) bool
 	IsTower(x, y int) bool
 	IsGatehouse(x, y int) bool
+	IsAlley(x, y int) bool
+
+	// features, which may overlap one another
+	IsFord(x, y int) bool
+	IsFerry(x, y int) bool
+	IsPlaza(x, y int) bool
+	IsMoat(x, y int) bool
+	IsChain(x, y int) bool
+	IsPostern(x, y int) bool
+	IsStairs(x, y int) bool
+
 	BuildingID(x, y int) (int, error)
 
 	// internal helper for IsWall || IsTower || IsGatehouse
@@ -70,8 +97,9 @@ type imageMap struct {
 	//       bit 2 -> isWall
 	//       bit 3 -> isTower
 	// 	 bit 4 -> isGatehouse
-	//       bit 5-7 -> unused
+	//       bit 5 -> isAlley
 	//
+	// Anything else (fords, plazas, moats ..) is held in features.
 	im *image.RGBA64
 
 	// temporary map for road / wall / tower / gatehouse network
@@ -83,6 +111,16 @@ type imageMap struct {
 	// mask for our drawing context. We mask out some areas as
 	// required so we cannot paint over them in later stages
 	mask *image.Alpha
+
+	// feature flags (see feature) for each pixel, for things other than
+	// roads / bridges / walls / towers / gatehouses. These are kept beside
+	// our main image as there's no room in it's bitmap. Features may be set
+	// before or after endDraw().
+	features []feature
+
+	// if set, roads / bridges / walls are drawn pixel exact as axis aligned
+	// lines rather than by the drawing lib
+	mode RoadMode
 }
 
 // ColourScheme defines how various features in a city should be coloured.
@@ -92,15 +130,54 @@ type ColourScheme struct {
 	Towers    color.Color
 	Gates     color.Color
 	Bridges   color.Color
+	Fords     color.Color
+	Ferries   color.Color
+	Plazas    color.Color
+	Alleys    color.Color
+	Moats     color.Color
+	Chains    color.Color
+	Posterns  color.Color
+	Stairs    color.Color
 	Buildings color.Color
 	Districts map[DistrictType]color.Color
 }
 
+// featureColour returns the colour for a pixel with the given features, or
+// nil if we have none (or no colour for them).
+// Where a pixel has more than one feature the first in this list wins.
+func (s *ColourScheme) featureColour(f feature) color.Color {
+	for _, fc := range []struct {
+		f   feature
+		col color.Color
+	}{
+		{featureStairs, s.Stairs},
+		{featurePostern, s.Posterns},
+		{featureChain, s.Chains},
+		{featureFord, s.Fords},
+		{featureFerry, s.Ferries},
+		{featurePlaza, s.Plazas},
+		{featureMoat, s.Moats},
+	} {
+		if f&fc.f != 0 && fc.col != nil {
+			return fc.col
+		}
+	}
+	return nil
+}
+
 // DefaultScheme returns a reasonable default ColourScheme.
 func DefaultScheme() *ColourScheme {
 	return &ColourScheme{
 		Roads:     colornames.Dimgray,
 		Bridges:   colornames.Darkgray,
+		Fords:     colornames.Tan,
+		Ferries:   colornames.Saddlebrown,
+		Plazas:    colornames.Lightgray,
+		Alleys:    colornames.Gray,
+		Moats:     colornames.Cadetblue,
+		Chains:    colornames.Slategray,
+		Posterns:  colornames.Peru,
+		Stairs:    colornames.Sienna,
 		Walls:     colornames.Black,
 		Towers:    colornames.Crimson,
 		Gates:     colornames.Black,
@@ -137,6 +214,9 @@ func (c *imageMap) setBuilding(x, y int, b *BuildingConfig) {
 	}
 	for dx := b.Area.Min.X; dx < b.Area.Max.X; dx++ {
 		for dy := b.Area.Min.Y; dy < b.Area.Max.Y; dy++ {
+			if !b.covers(dx, dy) {
+				continue
+			}
 			c.setBuildingID(x+dx, y+dy, b.ID)
 		}
 	}
@@ -171,6 +251,14 @@ func (c *imageMap) CustomImage(scheme *ColourScheme) (image.Image, error) {
 			} else if bm.Get(bitRoad) {
 				im.Set(dx, dy, scheme.Roads)
 				continue
+			} else if bm.Get(bitAlley) && scheme.Alleys != nil {
+				im.Set(dx, dy, scheme.Alleys)
+				continue
+			}
+
+			if col := scheme.featureColour(c.features[c.featureIndex(dx, dy)]); col != nil {
+				im.Set(dx, dy, col)
+				continue
 			}
 
 			buildingID, err := c.BuildingID(dx, dy)
@@ -267,6 +355,36 @@ func (c *imageMap) setBridge(x, y int) {
 	c.setBM(x, y, bm)
 }
 
+// setFeature sets the feature(s) f at x,y
+func (c *imageMap) setFeature(x, y int, f feature) {
+	if !image.Pt(x, y).In(c.mask.Bounds()) {
+		return
+	}
+	c.features[c.featureIndex(x, y)] |= f
+}
+
+// clearFeature clears the feature(s) f at x,y
+func (c *imageMap) clearFeature(x, y int, f feature) {
+	if !image.Pt(x, y).In(c.mask.Bounds()) {
+		return
+	}
+	c.features[c.featureIndex(x, y)] &^= f
+}
+
+// hasFeature returns if any of the feature(s) f are set at x,y
+func (c *imageMap) hasFeature(x, y int, f feature) bool {
+	if !image.Pt(x, y).In(c.mask.Bounds()) {
+		return false
+	}
+	return c.features[c.featureIndex(x, y)]&f != 0
+}
+
+// isBlank returns if nothing at all is set in the bitmap or features at x,y
+func (c *imageMap) isBlank(x, y int) bool {
+	_, bmdata := encoding.Split16(c.im.RGBA64At(x, y).A)
+	return bmdata == 0 && !c.hasFeature(x, y, ^feature(0))
+}
+
 // setBM sets the 8 bit bitmap at x,y
 func (c *imageMap) setBM(x, y int, bm bitmap.Bitmap) {
 	num := encoding.FromBytes8(bm.Data(true))
@@ -325,6 +443,11 @@ func (c *imageMap) IsRoad(x, y int) bool {
 	return c.getBM(x, y).Get(bitRoad)
 }
 
+// IsStairs returns if there is a stair (or ramp) up on to a wall at x,y
+func (c *imageMap) IsStairs(x, y int) bool {
+	return c.hasFeature(x, y, featureStairs)
+}
+
 // IsBridge returns if there is a bridge at x,y
 func (c *imageMap) IsBridge(x, y int) bool {
 	if c.isOutOfBounds(x, y) {
@@ -333,31 +456,62 @@ func (c *imageMap) IsBridge(x, y int) bool {
 	return c.getBM(x, y).Get(bitBridge)
 }
 
+// IsFord returns if there is a ford at x,y
+func (c *imageMap) IsFord(x, y int) bool {
+	return c.hasFeature(x, y, featureFord)
+}
+
+// IsFerry returns if there is a ferry crossing at x,y
+func (c *imageMap) IsFerry(x, y int) bool {
+	return c.hasFeature(x, y, featureFerry)
+}
+
+// IsPlaza returns if x,y is part of a plaza (see Citygraph.Plazas)
+func (c *imageMap) IsPlaza(x, y int) bool {
+	return c.hasFeature(x, y, featurePlaza)
+}
+
+// IsAlley returns if there is an alley at x,y
+func (c *imageMap) IsAlley(x, y int) bool {
+	if c.isOutOfBounds(x, y) {
+		return false
+	}
+	return c.getBM(x, y).Get(bitAlley)
+}
+
+// setAlley sets x,y as alley
+func (c *imageMap) setAlley(x, y int) {
+	bm := c.getBM(x, y)
+	bm.Set(bitAlley, true)
+	c.setBM(x, y, bm)
+}
+
+// IsMoat returns if there is a moat at x,y
+func (c *imageMap) IsMoat(x, y int) bool {
+	return c.hasFeature(x, y, featureMoat)
+}
+
+// IsChain returns if there is a harbour chain (or boom) at x,y
+func (c *imageMap) IsChain(x, y int) bool {
+	return c.hasFeature(x, y, featureChain)
+}
+
+// IsPostern returns if there is a postern (a narrow opening in a wall) at x,y
+func (c *imageMap) IsPostern(x, y int) bool {
+	return c.hasFeature(x, y, featurePostern)
+}
+
 // isOutOfBounds determines if x,y is outside of the image area
 func (c *imageMap) isOutOfBounds(x, y int) bool {
 	bnds := c.im.Bounds()
 	return x < bnds.Min.X || x > bnds.Max.X || y < bnds.Min.Y || y > bnds.Max.Y
 }
 
-// nearbyFortifications returns of any pixels within radius of x,y in `im`
-// are wall, gatehouse or tower
-func nearbyFortifications(x, y, radius int, im image.Image) bool {
-	for dy := y - radius; dy < y+radius; dy++ {
-		for dx := x - radius; dx < x+radius; dx++ {
-			_, _, b, _ := im.At(dx, dy).RGBA()
-			if b >= 50 {
-				return true
-			}
-		}
-	}
-	return false
-}
-
 // endDraw copies our rough road / wall outline sketch to our proper map.
 // Basically we paint roads / walls / towers / gatehouses because it's
 // much easier to lean on a graphics library & then copy the results
 // over to our main image later.
-func (c *imageMap) endDraw(wallBorderRoadWidth int, outline Outline) {
+func (c *imageMap) endDraw() {
 	temp := c.ctx.Image()
 	bnds := temp.Bounds()
 
@@ -368,36 +522,29 @@ func (c *imageMap) endDraw(wallBorderRoadWidth int, outline Outline) {
 			g = g >> 8
 			b = b >> 8
 
-			bm := bitmap.New(8)
-
 			if r == 0 && g == 0 && b == 0 {
-				road := outline.CanBuildOn(dx, dy)
-				water := outline.CanBridgeOver(dx, dy)
-				if (road || water) && nearbyFortifications(dx, dy, wallBorderRoadWidth, temp) {
-					bit := bitRoad
-					if water {
-						bit = bitBridge
-					}
-					bm.Set(bit, true)
-				} else {
-					continue
-				}
-			} else {
-				if g > 0 {
-					bm.Set(bitBridge, true) // bridge
-				}
+				continue
+			}
 
-				if b >= 150 {
-					bm.Set(bitGate, true)
-				} else if b >= 100 {
-					bm.Set(bitTower, true)
-				} else if b >= 50 {
-					bm.Set(bitWall, true)
-				}
+			// nb. anything drawn takes precedence over features marked while
+			// drawing (ie. where the end of a road runs on to a ford)
+			c.features[c.featureIndex(dx, dy)] = 0
 
-				if r > 0 {
-					bm.Set(bitRoad, true) // road
-				}
+			bm := bitmap.New(8)
+			if g > 0 {
+				bm.Set(bitBridge, true) // bridge
+			}
+
+			if b >= 150 {
+				bm.Set(bitGate, true)
+			} else if b >= 100 {
+				bm.Set(bitTower, true)
+			} else if b >= 50 {
+				bm.Set(bitWall, true)
+			}
+
+			if r > 0 {
+				bm.Set(bitRoad, true) // road
 			}
 
 			c.setBM(dx, dy, bm)
@@ -405,6 +552,21 @@ func (c *imageMap) endDraw(wallBorderRoadWidth int, outline Outline) {
 	}
 }
 
+// protectFortifications masks out all walls / towers / gatehouses drawn so
+// far, so that later drawing (ie. thick roads) cannot paint over them.
+func (c *imageMap) protectFortifications() {
+	temp := c.ctx.Image()
+	bnds := temp.Bounds()
+	for dy := bnds.Min.Y; dy < bnds.Max.Y; dy++ {
+		for dx := bnds.Min.X; dx < bnds.Max.X; dx++ {
+			_, _, b, _ := temp.At(dx, dy).RGBA()
+			if b > 0 {
+				c.mask.SetAlpha(dx, dy, color.Alpha{0})
+			}
+		}
+	}
+}
+
 // drawGatehouse (rect) on to our scratch image
 func (c *imageMap) drawGatehouse(a image.Point, width, height int) {
 	c.ctx.SetColor(color.RGBA{0, 0, 150, 255})
@@ -423,8 +585,36 @@ func (c *imageMap) drawTower(a image.Point, width, height int) {
 	draw.Draw(c.mask, image.Rect(a.X, a.Y, a.X+width, a.Y+height), image.Transparent, image.ZP, draw.Src)
 }
 
+// drawPolygon draws a polygon (ie. a bastion) as tower on to our scratch image
+func (c *imageMap) drawPolygon(poly []image.Point) {
+	temp, ok := c.ctx.Image().(*image.RGBA)
+	if !ok {
+		return
+	}
+	for _, p := range polygonPixels(poly) {
+		if !p.In(temp.Bounds()) || c.mask.AlphaAt(p.X, p.Y).A == 0 {
+			continue
+		}
+		temp.SetRGBA(p.X, p.Y, color.RGBA{0, 0, 100, 255})
+		// mark as non-drawable
+		c.mask.SetAlpha(p.X, p.Y, color.Alpha{0})
+	}
+}
+
+// isDrawnTower returns if we've drawn a tower or gatehouse at x,y on our
+// scratch image (ie. before endDraw)
+func (c *imageMap) isDrawnTower(x, y int) bool {
+	_, _, b, _ := c.ctx.Image().At(x, y).RGBA()
+	b = b >> 8
+	return b >= 100
+}
+
 // drawWall (line) on to our scratch image
 func (c *imageMap) drawWall(a, b image.Point, width int) {
+	if c.mode != DiagonalRoads {
+		c.fillLine(a, b, width, color.RGBA{0, 0, 50, 255})
+		return
+	}
 	c.ctx.SetColor(color.RGBA{0, 0, 50, 255})
 	c.ctx.SetLineWidth(float64(width))
 	c.ctx.SetLineCapSquare()
@@ -434,6 +624,10 @@ func (c *imageMap) drawWall(a, b image.Point, width int) {
 
 // drawBridge (line) on to our scratch image
 func (c *imageMap) drawBridge(a, b image.Point, width int) {
+	if c.mode != DiagonalRoads {
+		c.fillLine(a, b, width, color.RGBA{0, 255, 0, 255})
+		return
+	}
 	c.ctx.SetColor(color.RGBA{0, 255, 0, 255})
 	c.ctx.SetLineCapSquare()
 	c.ctx.SetLineWidth(float64(width))
@@ -443,6 +637,10 @@ func (c *imageMap) drawBridge(a, b image.Point, width int) {
 
 // drawRoad (line) on to our scratch image
 func (c *imageMap) drawRoad(a, b image.Point, width int) {
+	if c.mode != DiagonalRoads {
+		c.fillLine(a, b, width, color.RGBA{255, 0, 0, 255})
+		return
+	}
 	c.ctx.SetColor(color.RGBA{255, 0, 0, 255})
 	c.ctx.SetLineCapSquare()
 	c.ctx.SetLineWidth(float64(width))
@@ -450,6 +648,162 @@ func (c *imageMap) drawRoad(a, b image.Point, width int) {
 	c.ctx.Stroke()
 }
 
+// fillLine draws the line (a,b) on to our scratch image as axis aligned
+// rectangle(s) set pixel by pixel, so there are no partially filled pixels
+// along the edges as there would be with the drawing lib.
+func (c *imageMap) fillLine(a, b image.Point, width int, col color.RGBA) {
+	temp, ok := c.ctx.Image().(*image.RGBA)
+	if !ok {
+		return
+	}
+
+	// match the thickness of lines drawn with the drawing lib
+	lo, hi := 0, 0
+	if width > 1 {
+		lo, hi = -(width-1)/2, width/2
+	}
+
+	for _, l := range orthogonalise(a, b, c.mode) {
+		r := image.Rect(l[0].X, l[0].Y, l[1].X, l[1].Y)
+		r = image.Rect(r.Min.X+lo, r.Min.Y+lo, r.Max.X+hi+1, r.Max.Y+hi+1).Intersect(temp.Bounds())
+		for dy := r.Min.Y; dy < r.Max.Y; dy++ {
+			for dx := r.Min.X; dx < r.Max.X; dx++ {
+				if c.mask.AlphaAt(dx, dy).A == 0 {
+					continue
+				}
+				temp.SetRGBA(dx, dy, col)
+			}
+		}
+	}
+}
+
+// drawFord marks the line (a,b) as a ford
+func (c *imageMap) drawFord(a, b image.Point, width int) {
+	c.markFeature(a, b, width, featureFord)
+}
+
+// drawFerry marks the line (a,b) as a ferry crossing, with a landing (drawn as road) at either end
+func (c *imageMap) drawFerry(a, b image.Point, width, landing int, land Outline) {
+	c.markFeature(a, b, width, featureFerry)
+	c.drawLanding(a, landing, land)
+	c.drawLanding(b, landing, land)
+}
+
+// drawLanding draws a square landing (as road) of the given size centred on
+// p, only on pixels of dry land so that landings don't pave over the water.
+func (c *imageMap) drawLanding(p image.Point, size int, land Outline) {
+	temp, ok := c.ctx.Image().(*image.RGBA)
+	if !ok {
+		return
+	}
+
+	lo, hi := 0, 0
+	if size > 1 {
+		lo, hi = -(size-1)/2, size/2
+	}
+
+	r := image.Rect(p.X+lo, p.Y+lo, p.X+hi+1, p.Y+hi+1).Intersect(temp.Bounds())
+	for dy := r.Min.Y; dy < r.Max.Y; dy++ {
+		for dx := r.Min.X; dx < r.Max.X; dx++ {
+			if c.mask.AlphaAt(dx, dy).A == 0 || !land.CanBuildOn(dx, dy) {
+				continue
+			}
+			temp.SetRGBA(dx, dy, color.RGBA{255, 0, 0, 255})
+		}
+	}
+}
+
+// markFeature sets the feature for pixels along the line (a,b), as fillLine
+// but in our features rather than on the scratch image.
+func (c *imageMap) markFeature(a, b image.Point, width int, f feature) {
+	lo, hi := 0, 0
+	if width > 1 {
+		lo, hi = -(width-1)/2, width/2
+	}
+
+	bnds := c.mask.Bounds()
+	for _, l := range orthogonalise(a, b, c.mode) {
+		if l[0].X != l[1].X && l[0].Y != l[1].Y {
+			// a diagonal; mark the pixels along the line, filling in the
+			// corner wherever it steps diagonally so that it's walkable
+			pnts := line.PointsBetween(l[0], l[1])
+			for i, p := range pnts {
+				r := image.Rect(p.X+lo, p.Y+lo, p.X+hi+1, p.Y+hi+1).Intersect(bnds)
+				c.markArea(r, f)
+				if i > 0 && pnts[i-1].X != p.X && pnts[i-1].Y != p.Y {
+					r = image.Rect(p.X+lo, pnts[i-1].Y+lo, p.X+hi+1, pnts[i-1].Y+hi+1).Intersect(bnds)
+					c.markArea(r, f)
+				}
+			}
+			continue
+		}
+		r := image.Rect(l[0].X, l[0].Y, l[1].X, l[1].Y)
+		r = image.Rect(r.Min.X+lo, r.Min.Y+lo, r.Max.X+hi+1, r.Max.Y+hi+1).Intersect(bnds)
+		c.markArea(r, f)
+	}
+}
+
+// markArea sets the feature for all unmasked pixels in r
+func (c *imageMap) markArea(r image.Rectangle, f feature) {
+	for dy := r.Min.Y; dy < r.Max.Y; dy++ {
+		for dx := r.Min.X; dx < r.Max.X; dx++ {
+			if c.mask.AlphaAt(dx, dy).A == 0 {
+				continue
+			}
+			c.features[c.featureIndex(dx, dy)] |= f
+		}
+	}
+}
+
+// cutPostern clears the wall(s) from the given pixels of our scratch image &
+// marks them as a postern
+func (c *imageMap) cutPostern(pnts []image.Point) {
+	temp, ok := c.ctx.Image().(*image.RGBA)
+	if !ok {
+		return
+	}
+	for _, p := range pnts {
+		if !p.In(temp.Bounds()) {
+			continue
+		}
+		temp.SetRGBA(p.X, p.Y, color.RGBA{})
+		c.features[c.featureIndex(p.X, p.Y)] |= featurePostern
+		c.protect(p.X, p.Y)
+	}
+}
+
+// protect marks x,y as non-drawable (as walls / towers etc. are)
+func (c *imageMap) protect(x, y int) {
+	c.mask.SetAlpha(x, y, color.Alpha{0})
+}
+
+// isProtected returns if x,y is non-drawable
+func (c *imageMap) isProtected(x, y int) bool {
+	return c.mask.AlphaAt(x, y).A == 0
+}
+
+// featureIndex returns the index of x,y in our features
+func (c *imageMap) featureIndex(x, y int) int {
+	bnds := c.mask.Bounds()
+	return (y-bnds.Min.Y)*bnds.Dx() + (x - bnds.Min.X)
+}
+
+// drawRoadCurve (connected lines) on to our scratch image
+func (c *imageMap) drawRoadCurve(points []image.Point, width int) {
+	c.ctx.SetColor(color.RGBA{255, 0, 0, 255})
+	c.ctx.SetLineCapSquare()
+	c.ctx.SetLineJoinRound()
+	c.ctx.SetLineWidth(float64(width))
+	for i, p := range points {
+		if i == 0 {
+			c.ctx.MoveTo(float64(p.X), float64(p.Y))
+		} else {
+			c.ctx.LineTo(float64(p.X), float64(p.Y))
+		}
+	}
+	c.ctx.Stroke()
+}
+
 // newMap returns a new map with the given bounds
 func newMap(bounds image.Rectangle) *imageMap {
 	ctx := gg.NewContextForRGBA(image.NewRGBA(bounds))
@@ -465,8 +819,9 @@ func newMap(bounds image.Rectangle) *imageMap {
 	ctx.SetMask(mask)
 
 	return &imageMap{
-		ctx:  ctx,
-		im:   image.NewRGBA64(bounds),
-		mask: mask,
+		ctx:      ctx,
+		im:       image.NewRGBA64(bounds),
+		mask:     mask,
+		features: make([]feature, bounds.Dx()*bounds.Dy()),
 	}
 }
@@ -0,0 +1,105 @@
+package citygraph
+
+import (
+	"image"
+	"testing"
+)
+
+func TestFeaturesAreIndependent(t *testing.T) {
+	m := newMap(image.Rect(0, 0, 10, 10))
+
+	m.setFeature(3, 3, featureFord)
+	m.setFeature(3, 3, featurePlaza)
+	m.setFeature(3, 3, featureMoat)
+	if !m.IsFord(3, 3) || !m.IsPlaza(3, 3) || !m.IsMoat(3, 3) {
+		t.Errorf("expected ford, plaza & moat at (3,3)")
+	}
+	if m.IsFerry(3, 3) || m.IsChain(3, 3) || m.IsPostern(3, 3) || m.IsStairs(3, 3) {
+		t.Errorf("expected no other features at (3,3)")
+	}
+
+	m.clearFeature(3, 3, featurePlaza)
+	if m.IsPlaza(3, 3) {
+		t.Errorf("expected plaza cleared at (3,3)")
+	}
+	if !m.IsFord(3, 3) || !m.IsMoat(3, 3) {
+		t.Errorf("expected clearing the plaza to leave the ford & moat at (3,3)")
+	}
+
+	if m.hasFeature(3, 4, ^feature(0)) {
+		t.Errorf("expected no features at (3,4)")
+	}
+}
+
+func TestFeaturesLeaveBitmap(t *testing.T) {
+	m := newMap(image.Rect(0, 0, 10, 10))
+
+	m.setRoad(5, 5)
+	m.setAlley(5, 5)
+	m.setFeature(5, 5, featureStairs|featurePostern)
+	if !m.IsRoad(5, 5) || !m.IsAlley(5, 5) || m.IsBridge(5, 5) {
+		t.Errorf("expected road & alley (only) at (5,5)")
+	}
+	if !m.IsStairs(5, 5) || !m.IsPostern(5, 5) {
+		t.Errorf("expected stairs & postern at (5,5)")
+	}
+
+	m.clearFeature(5, 5, featureStairs|featurePostern)
+	if !m.IsRoad(5, 5) || !m.IsAlley(5, 5) {
+		t.Errorf("expected clearing features to leave the road & alley at (5,5)")
+	}
+}
+
+func TestFeaturesOutOfBounds(t *testing.T) {
+	m := newMap(image.Rect(0, 0, 10, 10))
+
+	for _, p := range []image.Point{{-1, 0}, {0, -1}, {10, 0}, {0, 10}} {
+		m.setFeature(p.X, p.Y, featureFord)
+		if m.IsFord(p.X, p.Y) {
+			t.Errorf("expected no ford out of bounds at %v", p)
+		}
+	}
+}
+
+func TestIsBlank(t *testing.T) {
+	m := newMap(image.Rect(0, 0, 10, 10))
+
+	if !m.isBlank(1, 1) {
+		t.Errorf("expected (1,1) blank")
+	}
+	m.setFeature(1, 1, featureChain)
+	if m.isBlank(1, 1) {
+		t.Errorf("expected (1,1) with a chain not to be blank")
+	}
+	m.setAlley(2, 2)
+	if m.isBlank(2, 2) {
+		t.Errorf("expected (2,2) with an alley not to be blank")
+	}
+}
+
+func TestMarkFeatureDiagonalIsWalkable(t *testing.T) {
+	m := newMap(image.Rect(0, 0, 20, 20))
+	m.mode = DiagonalRoads
+
+	m.markFeature(image.Pt(2, 2), image.Pt(12, 7), 1, featureFerry)
+
+	// walk the ferry from one end to the other, in steps of one pixel
+	// up, down, left or right
+	seen := map[image.Point]bool{{2, 2}: true}
+	queue := []image.Point{{2, 2}}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		for _, d := range []image.Point{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+			q := p.Add(d)
+			if seen[q] || !m.IsFerry(q.X, q.Y) {
+				continue
+			}
+			seen[q] = true
+			queue = append(queue, q)
+		}
+	}
+	if !seen[image.Pt(12, 7)] {
+		t.Errorf("expected to walk the ferry from (2,2) to (12,7)")
+	}
+}
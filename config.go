@@ -18,14 +18,18 @@ type DistrictConfig struct {
 	MinInCity                int
 	Probability              float64
 	Buildings                []*BuildingConfig
-	Central                  *BuildingConfig // a building that should be (if possible) centre of the district
-	RoadWidth                int             // width of roads within district
-	RoadDensity              float64         // higher values will create more roads
-	MaxBridges               int             // bridges allowed inside the district
-	MaxBuildings             int             // max number of buildings (of any type) in district (0 is 'no limit')
-	BuildingDensity          float64         // where 1 is "place a building where-ever possible" and 0 is "place nothing"
-	HasFortifications        bool            // true if the district is surrounded by city wall / towers / gatehouses
-	HasCurtainFortifications bool            // true if the district has it's own wall / towers / gatehouse
+	Central                  *BuildingConfig   // a building that should be (if possible) centre of the district
+	RoadWidth                int               // width of roads within district
+	RoadDensity              float64           // higher values will create more roads
+	RoadWiggle               float64           // how much roads curve (see CityConfig.MainRoadWiggle)
+	AlleyThreshold           int               // blocks longer than this are cut through by alleys (0 is 'no alleys')
+	MaxBridges               int               // bridges allowed on minor roads inside the district
+	MaxBuildings             int               // max number of buildings (of any type) in district (0 is 'no limit')
+	BuildingDensity          float64           // where 1 is "place a building where-ever possible" and 0 is "place nothing"
+	HasFortifications        bool              // true if the district is surrounded by city wall / towers / gatehouses
+	HasCurtainFortifications bool              // true if the district has it's own wall / towers / gatehouse
+	Tags                     map[string]string // arbitrary metadata copied on to each District of this type
+	Placement                PlacementStrategy // how buildings are laid out (see placement.go), SpiralPlacement if not set
 }
 
 // needsRoads returns if the district is configured to have roads (at all).
@@ -46,10 +50,12 @@ func (d *DistrictConfig) needsRoads() bool {
 type BuildingConfig struct {
 	ID            int // IDs are returned by citymap's BuildingID() and should be non-zero
 	Area          image.Rectangle
-	MaxInCity     int // ignored if 0
-	MaxInDistrict int // ignored if 0
+	Footprint     *Footprint // optional shape of the building within Area (ie. CrossFootprint), the whole Area if not set
+	MaxInCity     int        // ignored if 0
+	MaxInDistrict int        // ignored if 0
 	MinInDistrict int
 	Probability   float64
+	Tags          map[string]string // arbitrary metadata (ie. a name or asset key) copied on to each Building
 }
 
 // CityConfig hold configuaration for a given city.
@@ -63,13 +69,48 @@ type CityConfig struct {
 	// Should be divisable by 2.
 	MainRoadWidth int
 
-	// Max number of bridges (main roads between districts).
-	// Does *not* apply to bridges within districts (if MaxBridges
-	// is set in DistrictConfig(s))
+	// MainRoadWiggle curves the main roads between districts, as a fraction
+	// of the length of the road. Ie. 0.1 permits a road to stray up to 10%
+	// of it's length from a straight line. Junctions & bridges are never
+	// moved, and roads stay straight where a curve won't fit.
+	// 0 or less is "straight roads".
+	MainRoadWiggle float64
+
+	// RoadMode determines how roads & walls are laid out. By default they
+	// are drawn as straight (often diagonal) lines, alternatively they can be
+	// rebuilt as axis aligned "staircase" or "dogleg" lines drawn exactly to
+	// the pixel, which suits square tiles better. In this case Edge.Sections
+	// are all axis aligned & roads do not wiggle.
+	RoadMode RoadMode
+
+	// Width of arterial road(s); the major roads running from each gate (and
+	// each of ArterialEntryPoints) to the city Centre.
+	// Should be divisable by 2. Arterial roads are only added if this is set.
+	ArterialRoadWidth int
+
+	// ArterialEntryPoints are extra places (other than gates) from which we
+	// trace arterial roads to the city Centre. Ie. a harbour, a river crossing
+	// or where a road from another town enters the city.
+	ArterialEntryPoints []image.Point
+
+	// ExternalConnections are points on (or beyond) the border of the Area
+	// where roads from the outside world arrive, ie. a regional road. We route
+	// a main road from each to the nearest city gate we can reach (or the Centre
+	// if the city has no walls, or we can't reach any gate) & prefer to place
+	// city gates near them. These roads are marked as External. Any we can't
+	// route are listed in ConnectivityReport.UnroutedExternal.
+	ExternalConnections []image.Point
+
+	// Max number of bridges across the city on all roads other than minor
+	// roads within districts (ie. main, arterial, wall-side & connector roads).
+	// Does *not* apply to bridges on minor roads (see MaxBridges in
+	// DistrictConfig(s), which each have their own limit) or to drawbridges
+	// over a moat (see FortificationSettings.MoatWidth)
 	MaxBridges int // less than 0 implies "no max"
 
 	// MaxBridgeLength
-	// Applies to all (road) bridges over "bridgeable" tiles
+	// Applies to all (road) bridges over "bridgeable" tiles, but not to
+	// drawbridges over a moat
 	// 0 or less is "no max"
 	MaxBridgeLength int
 
@@ -79,6 +120,11 @@ type CityConfig struct {
 	// of waterways. Technically possible I guess, but certainly odd.
 	MinBridgeLength int
 
+	// Crossings configures other ways of crossing water where a bridge
+	// isn't permitted (ie. it's too long or we have no bridges left).
+	// Optional. If not given we simply don't cross.
+	Crossings *CrossingSettings
+
 	// Specify centres of districts.
 	// These are always placed as given. They count towards the district
 	// count for the purpose of min/max districts per city.
@@ -108,6 +154,15 @@ type CityConfig struct {
 	// eligable as "Docks" (DistrictType)
 	MinDockSize int
 
+	// Plazas if given carves open plazas at major junctions.
+	// Optional.
+	Plazas *PlazaSettings
+
+	// StreetNamer if given groups roads into named streets (see
+	// RoadNetwork.Streets) & gives each building an address on it's nearest
+	// street. See DefaultStreetNamer.
+	StreetNamer StreetNamer
+
 	// Seed for rng (random number chosen if not set)
 	Seed int64
 
@@ -133,6 +188,19 @@ type FortificationSettings struct {
 	// 0 or less is "no max"
 	MaxBridgeWallLength int
 
+	// WaterCrossing determines what (if anything) closes the wall where it
+	// crosses more water than MaxBridgeWallLength allows (see
+	// Citygraph.WaterDefences). By default the wall is simply left open.
+	// SeaWalls runs the wall along the shore instead, HarbourChains hangs a
+	// chain across the water between a pair of towers.
+	WaterCrossing WaterCrossing
+
+	// MaxChainLength is the longest chain we'll hang across the water (with
+	// HarbourChains). Over longer stretches we build walls (moles) out from
+	// either shore & hang the chain across the gap between them, making a
+	// water gate. 0 or less is "no max"
+	MaxChainLength int
+
 	// Thickness of walls of districts with curtain walls surrounding them
 	CurtainWallWidth int
 
@@ -151,6 +219,17 @@ type FortificationSettings struct {
 	// Dimensions of a gatehouse placed in walls to allow road(s)
 	GatehouseArea image.Rectangle
 
+	// Dimensions of towers at the corners of walls & of those flanking
+	// gatehouses. Either defaults to TowerArea if not set.
+	CornerTowerArea image.Rectangle
+	GateTowerArea   image.Rectangle
+
+	// CornerAngle is how sharply (in degrees) a wall must turn at a vertex
+	// for us to insist on a tower there, regardless of MinDistBetweenTowers.
+	// If the tower doesn't fit on the vertex we try nearby along the wall.
+	// 0 or less defaults to 30.
+	CornerAngle float64
+
 	// MinFortifiedSites ensures that the given number of districts are walled,
 	// selecting those of highest "value" / closest to the city centre (if for
 	// example enough district sites with "HasFortifications" or districts with
@@ -171,7 +250,103 @@ type FortificationSettings struct {
 	MinFortifiedSites int
 
 	// The width of road(s) that run alongside wall(s).
+	// Should be divisable by 2.
 	WallBorderRoadWidth int
+
+	// Style of the wall(s). By default walls have square towers along them,
+	// BastionWalls instead builds angular bastions on the outward pointing
+	// corners of the wall (see Citygraph.Bastions). Towers are still placed
+	// along the wall between bastions according to MinDistBetweenTowers.
+	Style WallStyle
+
+	// BastionSize is roughly how far bastions reach along & out from the wall.
+	// 0 or less defaults to twice the size of a tower.
+	BastionSize int
+
+	// Ravelins if set (with BastionWalls) builds a ravelin, a detached
+	// triangular outwork, in front of each gate (see Citygraph.Ravelins).
+	Ravelins bool
+
+	// MoatWidth if set digs a moat of this width along the outside face of
+	// the main city wall (see Citygraph.Moats). Roads crossing the moat are
+	// bridged, as drawbridges where they lead to a gate. Drawbridges aren't
+	// counted against (or limited by) MaxBridges or MaxBridgeLength, though
+	// they are counted in the Bridges of their Road & DistrictStats.
+	MoatWidth int
+
+	// MaxPosterns if set cuts up to this many posterns (narrow openings
+	// without a gatehouse) through each wall, where minor roads run up to the
+	// wall (see Citygraph.Posterns). Posterns are kept at least
+	// PosternSpacing from each other & from gates (0 or less defaults to
+	// MinDistBetweenTowers) & are PosternWidth pixels wide (0 or less
+	// defaults to 2).
+	MaxPosterns    int
+	PosternSpacing int
+	PosternWidth   int
+
+	// StairInterval if set places stairs up on to the wall walk along the
+	// inside face of each wall roughly this many pixels apart, as well as
+	// beside each gatehouse (see Citygraph.Stairs). Each is StairLength
+	// pixels long (0 or less defaults to twice the width of a tower) & is
+	// linked to the nearest road by a ConnectorRoad. Stairs are only built on clear land, so
+	// few fit where WallBorderRoadWidth runs roads along the walls. Ramps
+	// builds ramps instead of stairs, which are twice as long.
+	StairInterval int
+	StairLength   int
+	Ramps         bool
+
+	// Rings optionally adds inner rings of wall within the main city wall
+	// (ie. an older city wall, or a citadel). Rings are listed outermost
+	// first & each encloses some of the districts of the ring outside it.
+	Rings []*RingSettings
+}
+
+// RingSettings configures an inner ring of city wall (see FortificationSettings.Rings).
+// Settings that aren't set (are 0) default to those of the main city wall.
+type RingSettings struct {
+	// The ring encloses the MinFortifiedSites districts closest to the
+	// city centre, or if Radius is set, all districts whose site is within
+	// Radius of the centre.
+	MinFortifiedSites int
+	Radius            int
+
+	WallWidth            int
+	MinDistBetweenTowers int
+	MaxCityGates         int
+}
+
+// CrossingSettings configures fords & ferries.
+type CrossingSettings struct {
+	// Fords are permitted where every pixel of water is shallow enough.
+	// Requires that the Outline implements FordOutline.
+	Fords bool
+
+	// Ferries are permitted across water up to MaxFerryLength pixels
+	// (0 or less is "no max").
+	Ferries        bool
+	MaxFerryLength int
+
+	// Size of the (square) landing built at each end of a ferry crossing,
+	// on whatever dry land falls within it.
+	// 0 or less defaults to twice the width of the road.
+	FerryLandingSize int
+}
+
+// PlazaSettings configures plazas placed at major junctions
+type PlazaSettings struct {
+	// place a plaza where at least this many main roads meet (arterial
+	// roads count as main roads here). 0 or less implies "never"
+	MinRoads int
+
+	// place a plaza where arterial roads cross (or meet)
+	ArterialCrossings bool
+
+	// area of each plaza, centred on the junction
+	Area image.Rectangle
+
+	// optional feature (ie. a fountain) placed in the middle of each plaza.
+	// This is placed only if it fits clear of the roads.
+	Feature *BuildingConfig
 }
 
 // DistrictSite allows one to specify where a specific district by type sits
@@ -183,8 +358,9 @@ type FortificationSettings struct {
 // - a Temple district on a designated holy site
 // - etc
 type DistrictSite struct {
-	Type                     DistrictType // defined in district_types.go
-	Site                     image.Point  // district centre (approx for voronoi)
-	HasFortifications        bool         // true if the district is surrounded by city wall / towers / gatehouses
-	HasCurtainFortifications bool         // true if the district has it's own wall / towers / gatehouse
+	Type                     DistrictType      // defined in district_types.go
+	Site                     image.Point       // district centre (approx for voronoi)
+	HasFortifications        bool              // true if the district is surrounded by city wall / towers / gatehouses
+	HasCurtainFortifications bool              // true if the district has it's own wall / towers / gatehouse
+	Tags                     map[string]string // arbitrary metadata copied on to the District (overriding DistrictConfig.Tags)
 }
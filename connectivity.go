@@ -0,0 +1,362 @@
+package citygraph
+
+import (
+	"container/heap"
+	"image"
+	"math"
+	"sort"
+)
+
+// minComponentSize is the smallest number of pixels a group of connected
+// road pixels must have for us to bother connecting it to the rest of the city.
+// Smaller groups are usually scraps of road painted around walls.
+const minComponentSize = 10
+
+// ConnectivityReport explains how well connected the road network of the
+// city is (where travel is permitted along roads, bridges & through gatehouses).
+type ConnectivityReport struct {
+	// number of separate groups of connected roads we found before adding
+	// any connectors
+	Components int
+
+	// IDs of the roads (see RoadNetwork) we added to join groups of roads
+	Connectors []int `json:",omitempty"`
+
+	// IDs of districts with buildable land that cannot be reached from
+	// the largest group of roads
+	Unreachable []int `json:",omitempty"`
+
+	// CityConfig.ExternalConnections that we couldn't route a road in from,
+	// to any gate or the Centre
+	UnroutedExternal []image.Point `json:",omitempty"`
+}
+
+// connectivity holds what we need while connecting up the road network
+type connectivity struct {
+	c      *Citygraph
+	bounds image.Rectangle
+
+	// component label of each pixel (0 is "not a road"), the size of each
+	// component & the pixels (indexes) in each
+	labels  []int
+	sizes   []int
+	members [][]int
+}
+
+// addConnectors joins up disconnected groups of roads with the cheapest
+// connecting roads & bridges that we can (within our bridge limits) & reports
+// any districts that still can't be reached.
+// Must be called after endDraw as we work from the final map.
+func (c *Citygraph) addConnectors() *ConnectivityReport {
+	cn := &connectivity{c: c, bounds: c.cfg.Area}
+	report := &ConnectivityReport{Connectors: []int{}, Unreachable: []int{}, UnroutedExternal: c.unroutedExternal}
+
+	largest := cn.label()
+	for _, size := range cn.sizes[1:] {
+		if size >= minComponentSize {
+			report.Components++
+		}
+	}
+
+	allowWater := c.cfg.MaxBridges < 0 || c.bridges < c.cfg.MaxBridges
+	for largest > 0 {
+		roads, exhausted := cn.connect(largest, allowWater)
+		for _, r := range roads {
+			report.Connectors = append(report.Connectors, r.ID)
+		}
+		if !exhausted {
+			break
+		}
+		// we ran out of bridges part way, so try again by land only
+		allowWater = false
+		largest = cn.label()
+	}
+
+	largest = cn.label()
+	for _, d := range c.Districts {
+		if d.Stats.Buildable == 0 || d.Type == Empty || cn.reaches(largest, d) {
+			continue
+		}
+		report.Unreachable = append(report.Unreachable, d.ID)
+	}
+
+	return report
+}
+
+// reaches returns if the group of pixels with the given label runs through
+// (or along the edge of) the district
+func (cn *connectivity) reaches(label int, d *District) bool {
+	if label == 0 {
+		return false
+	}
+	site := cn.c.graph.SiteByID(d.ID)
+	if site == nil {
+		return false
+	}
+	bnds := site.Bounds().Inset(-1).Intersect(cn.bounds)
+	for y := bnds.Min.Y; y < bnds.Max.Y; y++ {
+		for x := bnds.Min.X; x < bnds.Max.X; x++ {
+			if cn.labels[cn.index(image.Pt(x, y))] != label {
+				continue
+			}
+			for _, n := range []image.Point{{0, 0}, {1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+				if site.Contains(x+n.X, y+n.Y) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// walkable returns if we can travel over the pixel at x,y
+func (cn *connectivity) walkable(x, y int) bool {
+	cm := cn.c.cmap
+	return cm.IsRoad(x, y) || cm.IsBridge(x, y) || cm.IsGatehouse(x, y) || cm.IsFord(x, y) || cm.IsFerry(x, y) || cm.IsAlley(x, y) || cm.IsPostern(x, y)
+}
+
+// index returns the index of p in our pixel arrays
+func (cn *connectivity) index(p image.Point) int {
+	return (p.Y-cn.bounds.Min.Y)*cn.bounds.Dx() + (p.X - cn.bounds.Min.X)
+}
+
+// point returns the point with the given index in our pixel arrays
+func (cn *connectivity) point(i int) image.Point {
+	w := cn.bounds.Dx()
+	return image.Pt(i%w+cn.bounds.Min.X, i/w+cn.bounds.Min.Y)
+}
+
+// label flood fills all walkable pixels into groups of connected pixels
+// & returns the label of the largest group (or 0 if there are none)
+func (cn *connectivity) label() int {
+	cn.labels = make([]int, cn.bounds.Dx()*cn.bounds.Dy())
+	cn.sizes = []int{0}
+	cn.members = [][]int{nil}
+
+	largest := 0
+	for i := range cn.labels {
+		p := cn.point(i)
+		if cn.labels[i] != 0 || !cn.walkable(p.X, p.Y) {
+			continue
+		}
+
+		label := len(cn.sizes)
+		cn.sizes = append(cn.sizes, 0)
+		cn.members = append(cn.members, []int{})
+		cn.labels[i] = label
+
+		queue := []image.Point{p}
+		for len(queue) > 0 {
+			q := queue[0]
+			queue = queue[1:]
+			cn.sizes[label]++
+			cn.members[label] = append(cn.members[label], cn.index(q))
+			for _, d := range []image.Point{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+				n := q.Add(d)
+				if !n.In(cn.bounds) || !cn.walkable(n.X, n.Y) {
+					continue
+				}
+				ni := cn.index(n)
+				if cn.labels[ni] != 0 {
+					continue
+				}
+				cn.labels[ni] = label
+				queue = append(queue, n)
+			}
+		}
+
+		if largest == 0 || cn.sizes[label] > cn.sizes[largest] {
+			largest = label
+		}
+	}
+
+	return largest
+}
+
+// connect grows outward from the `from` group of pixels, joining each group
+// it reaches with the cheapest path it can find. Since each group joined
+// becomes part of the `from` group, this connects every group we can reach.
+// We return the roads added & whether we stopped early because we ran out of
+// bridges.
+func (cn *connectivity) connect(from int, allowWater bool) ([]*Road, bool) {
+	c := cn.c
+	size := len(cn.labels)
+
+	costs := make([]float64, size)
+	parent := make([]int, size)
+	water := make([]int, size) // length of the bridge we're currently on
+	for i := range costs {
+		costs[i] = math.Inf(1)
+		parent[i] = -1
+	}
+
+	joined := map[int]bool{from: true}
+	open := &routeQueue{}
+	seed := func(i int, cost float64) {
+		costs[i] = cost
+		parent[i] = -1
+		water[i] = 0
+		heap.Push(open, &routeNode{i: i, f: cost})
+	}
+	addGroup := func(label int, cost float64) {
+		for _, i := range cn.members[label] {
+			seed(i, cost)
+		}
+	}
+	addGroup(from, 0)
+
+	added := []*Road{}
+	for open.Len() > 0 {
+		n := heap.Pop(open).(*routeNode)
+		if n.f > costs[n.i] {
+			continue
+		}
+
+		label := cn.labels[n.i]
+		if label != 0 && !joined[label] && cn.sizes[label] >= minComponentSize {
+			// every pixel from here back to where we started, the first & last are
+			// already roads
+			chain := []image.Point{cn.point(n.i)}
+			for i := n.i; parent[i] != -1; i = parent[i] {
+				chain = append(chain, cn.point(parent[i]))
+			}
+			path := chain[1 : len(chain)-1]
+
+			// each stretch of water we cross is a bridge of it's own
+			bridges := cn.waterRuns(path)
+			if c.cfg.MaxBridges >= 0 && c.bridges+len(bridges) > c.cfg.MaxBridges {
+				return added, true
+			}
+			for _, b := range bridges {
+				c.bridges++
+				c.countBridge(b)
+			}
+
+			if r := cn.addRoad(chain); r != nil {
+				added = append(added, r)
+			}
+			for _, p := range path {
+				// the new road is now part of our group, so we grow from it too
+				cn.labels[cn.index(p)] = from
+				seed(cn.index(p), n.f)
+			}
+			joined[label] = true
+			addGroup(label, n.f)
+			continue
+		}
+
+		p := cn.point(n.i)
+		for _, d := range []image.Point{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+			q := p.Add(d)
+			if !q.In(cn.bounds) {
+				continue
+			}
+			qi := cn.index(q)
+
+			step := 0.0
+			run := 0
+			if cn.labels[qi] != 0 || c.outline.CanBuildOn(q.X, q.Y) {
+				if water[n.i] > 0 && water[n.i] < c.cfg.MinBridgeLength {
+					continue // a bridge can't land here, it's too short
+				}
+			}
+			if cn.labels[qi] != 0 {
+				step = 1 // travelling along a road that isn't (yet) connected
+			} else if c.cmap.isFortification(q.X, q.Y) || c.cmap.IsMoat(q.X, q.Y) {
+				continue // the moat is only crossed by the drawbridges at gates
+			} else if c.cmap.IsChain(q.X, q.Y) {
+				continue // nor can we bridge over a harbour chain
+			} else if c.outline.CanBuildOn(q.X, q.Y) {
+				step = 1
+			} else if allowWater && c.outline.CanBridgeOver(q.X, q.Y) {
+				run = water[n.i] + 1
+				if c.cfg.MaxBridgeLength > 0 && run > c.cfg.MaxBridgeLength {
+					continue
+				}
+				step = 2
+			} else {
+				continue
+			}
+
+			total := costs[n.i] + step
+			if total >= costs[qi] {
+				continue
+			}
+			costs[qi] = total
+			parent[qi] = n.i
+			water[qi] = run
+			heap.Push(open, &routeNode{i: qi, f: total})
+		}
+	}
+
+	return added, false
+}
+
+// waterRuns returns the first & last pixels of each unbroken stretch of
+// water along the path (each of which needs a bridge)
+func (cn *connectivity) waterRuns(path []image.Point) [][2]image.Point {
+	runs := [][2]image.Point{}
+	for i, p := range path {
+		if cn.c.outline.CanBuildOn(p.X, p.Y) {
+			continue
+		}
+		if i > 0 && !cn.c.outline.CanBuildOn(path[i-1].X, path[i-1].Y) {
+			runs[len(runs)-1][1] = p
+			continue
+		}
+		runs = append(runs, [2]image.Point{p, p})
+	}
+	return runs
+}
+
+// addRoad draws a connecting road along the given pixels (each next to the
+// last) & adds it to the RoadNetwork. The first & last pixels are the roads
+// that we're connecting, so aren't drawn.
+func (cn *connectivity) addRoad(chain []image.Point) *Road {
+	c := cn.c
+	path := chain[1 : len(chain)-1]
+
+	sections := []*Section{}
+	districts := map[int]bool{}
+	for i, p := range path {
+		districts[c.graph.SiteFor(p.X, p.Y).ID()] = true
+
+		isBridge := !c.outline.CanBuildOn(p.X, p.Y)
+		if isBridge {
+			c.cmap.setBridge(p.X, p.Y)
+		} else {
+			c.cmap.setRoad(p.X, p.Y)
+		}
+
+		// join pixels into straight sections of road / bridge
+		if i > 0 && len(sections) > 0 {
+			s := sections[len(sections)-1]
+			prev := path[i-1]
+			straight := (s.Path[0].X == p.X && prev.X == p.X) || (s.Path[0].Y == p.Y && prev.Y == p.Y)
+			if s.Bridge == isBridge && (straight || s.Path[0] == s.Path[1]) {
+				s.Path[1] = p
+				continue
+			}
+		}
+		sections = append(sections, &Section{Path: [2]image.Point{p, p}, Bridge: isBridge})
+	}
+	if len(sections) == 0 {
+		return nil
+	}
+
+	e := &Edge{Path: [2]image.Point{chain[0], chain[len(chain)-1]}, Sections: sections}
+	r := c.RoadNetwork.add(e, 1, ConnectorRoad)
+
+	ids := []int{}
+	for id := range districts {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		if d, ok := c.cellToDist[id]; ok {
+			c.shareRoad(r, d)
+		}
+	}
+
+	return r
+}
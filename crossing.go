@@ -0,0 +1,55 @@
+package citygraph
+
+import (
+	"image"
+
+	"github.com/voidshard/citygraph/internal/line"
+)
+
+// addCrossing crosses the water along path (which we aren't permitted to
+// bridge) with a ford or ferry, as allowed by CityConfig.Crossings.
+// Fords are preferred where the water is shallow enough.
+// Returns nil if we cannot cross.
+func (c *Citygraph) addCrossing(path [2]image.Point, width int) *Section {
+	cs := c.cfg.Crossings
+	if cs == nil {
+		return nil
+	}
+
+	if cs.Fords && c.canFord(path[0], path[1]) {
+		c.cmap.drawFord(path[0], path[1], width)
+		return &Section{Path: path, Kind: FordSection}
+	}
+
+	if cs.Ferries {
+		flen := int(calculateDist(path[0].X, path[0].Y, path[1].X, path[1].Y))
+		if cs.MaxFerryLength > 0 && flen > cs.MaxFerryLength {
+			return nil
+		}
+		landing := cs.FerryLandingSize
+		if landing <= 0 {
+			landing = width * 2
+		}
+		c.cmap.drawFerry(path[0], path[1], 1, landing, c.outline)
+		return &Section{Path: path, Kind: FerrySection}
+	}
+
+	return nil
+}
+
+// canFord returns if every pixel along (a,b) is shallow enough to ford,
+// which requires that our Outline implements FordOutline
+func (c *Citygraph) canFord(a, b image.Point) bool {
+	fo, ok := c.outline.(FordOutline)
+	if !ok {
+		return false
+	}
+	for _, l := range orthogonalise(a, b, c.cfg.RoadMode) {
+		for _, p := range line.PointsBetween(l[0], l[1]) {
+			if !c.outline.CanBuildOn(p.X, p.Y) && !fo.CanFord(p.X, p.Y) {
+				return false
+			}
+		}
+	}
+	return true
+}
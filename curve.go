@@ -0,0 +1,111 @@
+package citygraph
+
+import (
+	"image"
+	"math"
+	"math/rand"
+
+	"github.com/voidshard/citygraph/internal/voronoi"
+)
+
+const (
+	// roughly how far apart (in pixels) the control points of a curved road are
+	curveSpacing = 24.0
+
+	// number of points we sample between each pair of control points
+	curveSamples = 6
+)
+
+// curve returns the points a road between (a,b) should follow if it is to
+// wiggle by `amount` (see CityConfig.MainRoadWiggle). The first & last
+// points are always a & b, so junctions don't move.
+// We return nil if the road should be straight, either because no wiggle is
+// wanted, roads are orthogonal (see CityConfig.RoadMode) or because the curve
+// would leave the site (if given) or cross something we can't put a road on.
+func (c *Citygraph) curve(a, b image.Point, amount float64, site voronoi.Site) []image.Point {
+	if amount <= 0 || c.cfg.RoadMode != DiagonalRoads {
+		return nil
+	}
+
+	points := wiggle(a, b, amount, c.cfg.Seed)
+	if len(points) < 3 {
+		return nil
+	}
+
+	for i := 1; i < len(points); i++ {
+		roads, bridges, walls := c.lineSegments(points[i-1], points[i], site)
+		if len(bridges)+len(walls) > 0 || len(roads) != 1 {
+			return nil
+		}
+		if edgeID(roads[0][0], roads[0][1]) != edgeID(points[i-1], points[i]) {
+			return nil // part of the line isn't buildable
+		}
+	}
+
+	return points
+}
+
+// wiggle displaces control points along (a,b) by seeded noise & joins them
+// with a Catmull-Rom spline. The result is deterministic for a given seed &
+// pair of points (regardless of their order).
+func wiggle(a, b image.Point, amount float64, seed int64) []image.Point {
+	length := calculateDist(a.X, a.Y, b.X, b.Y)
+	controls := int(length / curveSpacing)
+	if controls < 1 {
+		return []image.Point{a, b}
+	}
+
+	// seed from the points so that shared edges always wiggle the same way
+	lo, hi := a, b
+	if hi.X < lo.X || (hi.X == lo.X && hi.Y < lo.Y) {
+		lo, hi = hi, lo
+	}
+	rng := rand.New(rand.NewSource(seed ^ int64(lo.X*73856093^lo.Y*19349663^hi.X*83492791^hi.Y*50331653)))
+
+	// unit vector perpendicular to the line
+	px := -float64(b.Y-a.Y) / length
+	py := float64(b.X-a.X) / length
+
+	// the furthest a control point may be moved; we don't go further than the
+	// spacing between points or the curve starts to double back on itself
+	amplitude := math.Min(amount*length, curveSpacing)
+
+	xs := []float64{float64(a.X)}
+	ys := []float64{float64(a.Y)}
+	for i := 1; i <= controls; i++ {
+		t := float64(i) / float64(controls+1)
+		offset := (rng.Float64()*2 - 1) * amplitude
+		xs = append(xs, float64(a.X)+t*float64(b.X-a.X)+px*offset)
+		ys = append(ys, float64(a.Y)+t*float64(b.Y-a.Y)+py*offset)
+	}
+	xs = append(xs, float64(b.X))
+	ys = append(ys, float64(b.Y))
+
+	points := []image.Point{a}
+	for i := 0; i < len(xs)-1; i++ {
+		// the end points are repeated so the curve passes through them
+		i0, i3 := maxint(i-1, 0), i+2
+		if i3 >= len(xs) {
+			i3 = len(xs) - 1
+		}
+		for s := 1; s <= curveSamples; s++ {
+			t := float64(s) / curveSamples
+			x := catmullRom(xs[i0], xs[i], xs[i+1], xs[i3], t)
+			y := catmullRom(ys[i0], ys[i], ys[i+1], ys[i3], t)
+			p := image.Pt(int(math.Round(x)), int(math.Round(y)))
+			if p != points[len(points)-1] {
+				points = append(points, p)
+			}
+		}
+	}
+	points[len(points)-1] = b
+
+	return points
+}
+
+// catmullRom returns the value at t (0-1) of a Catmull-Rom spline between p1 & p2
+func catmullRom(p0, p1, p2, p3, t float64) float64 {
+	t2 := t * t
+	t3 := t2 * t
+	return 0.5 * ((2 * p1) + (-p0+p2)*t + (2*p0-5*p1+4*p2-p3)*t2 + (-p0+3*p1-3*p2+p3)*t3)
+}
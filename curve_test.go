@@ -0,0 +1,79 @@
+package citygraph
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func TestCatmullRom(t *testing.T) {
+	cases := []struct {
+		name           string
+		p0, p1, p2, p3 float64
+		t              float64
+		expect         float64
+	}{
+		{"start", 0, 1, 2, 3, 0, 1},
+		{"end", 0, 1, 2, 3, 1, 2},
+		{"evenly spaced is linear", 0, 1, 2, 3, 0.25, 1.25},
+		{"evenly spaced mid", 0, 10, 20, 30, 0.5, 15},
+		{"flat", 5, 5, 5, 5, 0.7, 5},
+		{"repeated end points", 4, 4, 8, 8, 0.5, 6},
+	}
+	for _, tc := range cases {
+		got := catmullRom(tc.p0, tc.p1, tc.p2, tc.p3, tc.t)
+		if math.Abs(got-tc.expect) > 1e-9 {
+			t.Errorf("%s: expected %v got %v", tc.name, tc.expect, got)
+		}
+	}
+}
+
+func TestWiggle(t *testing.T) {
+	cases := []struct {
+		name   string
+		a, b   image.Point
+		amount float64
+	}{
+		{"zero length", image.Pt(10, 10), image.Pt(10, 10), 0.2},
+		{"too short to wiggle", image.Pt(0, 0), image.Pt(10, 0), 0.2},
+		{"horizontal", image.Pt(0, 50), image.Pt(200, 50), 0.1},
+		{"vertical", image.Pt(50, 0), image.Pt(50, 200), 0.1},
+		{"diagonal", image.Pt(0, 0), image.Pt(150, 120), 0.3},
+		{"no wiggle", image.Pt(0, 50), image.Pt(200, 50), 0},
+	}
+	for _, tc := range cases {
+		points := wiggle(tc.a, tc.b, tc.amount, 42)
+
+		if len(points) < 2 || points[0] != tc.a || points[len(points)-1] != tc.b {
+			t.Errorf("%s: expected a path from %v to %v, got %v", tc.name, tc.a, tc.b, points)
+			continue
+		}
+
+		if len(points) != 2 && calculateDist(tc.a.X, tc.a.Y, tc.b.X, tc.b.Y) < curveSpacing {
+			t.Errorf("%s: expected a straight line for a short segment, got %v", tc.name, points)
+		}
+
+		again := wiggle(tc.a, tc.b, tc.amount, 42)
+		if len(again) != len(points) {
+			t.Errorf("%s: expected the same path for the same seed", tc.name)
+		}
+
+		// no point strays further from the line than a control point may
+		// move (plus a little for the spline overshooting)
+		length := calculateDist(tc.a.X, tc.a.Y, tc.b.X, tc.b.Y)
+		limit := math.Min(tc.amount*length, curveSpacing)*1.5 + 1
+		for i, p := range points {
+			if i > 0 && p == points[i-1] && tc.a != tc.b {
+				t.Errorf("%s: expected no repeated points, got %v twice", tc.name, p)
+			}
+			if length == 0 {
+				continue
+			}
+			// distance of p from the (infinite) line through a & b
+			d := math.Abs(float64((tc.b.X-tc.a.X)*(tc.a.Y-p.Y)-(tc.a.X-p.X)*(tc.b.Y-tc.a.Y))) / length
+			if d > limit {
+				t.Errorf("%s: expected %v within %v of the line, got %v", tc.name, p, limit, d)
+			}
+		}
+	}
+}
@@ -44,14 +44,15 @@ func main() {
 
 	bcfg := defaultConfig()
 	cfg := &citygraph.CityConfig{
-		Area:             image.Rect(0, 0, 1000, 1000), // area of entire city
-		MainRoadWidth:    4,                            // width of main roads (between districts)
-		MaxBridges:       -1,                           // any number of bridges for main roads
-		MaxBridgeLength:  15,                           // keeping the max smallish prevents wacky diagonal bridges
-		MinBridgeLength:  10,                           // ideally set to min river width
-		MinDistrictSize:  150,                          // min "buildable" pixels in a district to aim for (approx)
-		DesiredDistricts: 100,                          // how many districts we want to end up with
-		MinDockSize:      10,                           // min "suitable dock" pixels to mark a district as "Docks"
+		Area:              image.Rect(0, 0, 1000, 1000), // area of entire city
+		MainRoadWidth:     4,                            // width of main roads (between districts)
+		ArterialRoadWidth: 8,                            // width of roads from gates to the centre
+		MaxBridges:        -1,                           // any number of bridges for main roads
+		MaxBridgeLength:   15,                           // keeping the max smallish prevents wacky diagonal bridges
+		MinBridgeLength:   10,                           // ideally set to min river width
+		MinDistrictSize:   150,                          // min "buildable" pixels in a district to aim for (approx)
+		DesiredDistricts:  100,                          // how many districts we want to end up with
+		MinDockSize:       10,                           // min "suitable dock" pixels to mark a district as "Docks"
 		Fortifications: &citygraph.FortificationSettings{ // optional, configures city walls
 			MaxBridgeWallLength:  0,                      // how far a wall can span over "bridgeable" pixels
 			MinFortifiedSites:    6,                      // the number of districts we want within the city walls
@@ -0,0 +1,129 @@
+package citygraph
+
+import (
+	"image"
+	"sort"
+)
+
+// maxExternalStarts is the number of nodes (nearest first) we'll try to route
+// from when tracing a road in from an external connection
+const maxExternalStarts = 10
+
+// borderPoint returns the point on the border of the city Area closest to p
+func (c *Citygraph) borderPoint(p image.Point) image.Point {
+	bnds := c.cfg.Area
+	x := maxint(bnds.Min.X, p.X)
+	if x > bnds.Max.X-1 {
+		x = bnds.Max.X - 1
+	}
+	y := maxint(bnds.Min.Y, p.Y)
+	if y > bnds.Max.Y-1 {
+		y = bnds.Max.Y - 1
+	}
+
+	if c.onBorder(image.Pt(x, y)) {
+		return image.Pt(x, y)
+	}
+
+	// the point is inside the Area, so move it to the nearest edge
+	left, right := x-bnds.Min.X, bnds.Max.X-1-x
+	top, bottom := y-bnds.Min.Y, bnds.Max.Y-1-y
+	switch {
+	case left <= right && left <= top && left <= bottom:
+		x = bnds.Min.X
+	case right <= top && right <= bottom:
+		x = bnds.Max.X - 1
+	case top <= bottom:
+		y = bnds.Min.Y
+	default:
+		y = bnds.Max.Y - 1
+	}
+	return image.Pt(x, y)
+}
+
+// addExternalRoads routes a main road from each of our ExternalConnections to
+// the nearest gate in the (outermost) city wall, or to the Centre if there are
+// no city gates. Where we can't reach the nearest gate we try the next nearest
+// & so on, then the Centre. We return any connections we couldn't route at all.
+func (c *Citygraph) addExternalRoads() []image.Point {
+	g := c.newEdgeGraph()
+	width := c.cfg.MainRoadWidth
+
+	gates := []*gateLocation{}
+	for _, gate := range c.gateLocs {
+		if gate.ring == 0 && !gate.InDist.HasCurtainFortifications {
+			gates = append(gates, gate)
+		}
+	}
+	gateCentre := func(gate *gateLocation) image.Point {
+		return image.Pt((gate.Gatehouse.Min.X+gate.Gatehouse.Max.X)/2, (gate.Gatehouse.Min.Y+gate.Gatehouse.Max.Y)/2)
+	}
+
+	unrouted := []image.Point{}
+	for _, p := range c.cfg.ExternalConnections {
+		entry := c.borderPoint(p)
+
+		// work out where we could head (nearest gate first) & how the road
+		// ends for each
+		type destination struct {
+			target image.Point
+			finish [][2]image.Point
+		}
+		dests := []destination{}
+
+		sort.SliceStable(gates, func(i, k int) bool {
+			a, b := gateCentre(gates[i]), gateCentre(gates[k])
+			return calculateDist(entry.X, entry.Y, a.X, a.Y) < calculateDist(entry.X, entry.Y, b.X, b.Y)
+		})
+		for _, gate := range gates {
+			gc := gateCentre(gate)
+			_, out := c.gateApproach(gate)
+			vout, ok := c.nearestVertex(out, gate.Out)
+			if !ok {
+				continue
+			}
+			dests = append(dests, destination{vout, [][2]image.Point{{vout, out}, {out, gc}}})
+		}
+		if centre, ok := g.nearest(c.cfg.Centre, nil); ok {
+			dests = append(dests, destination{centre, nil})
+		}
+
+		// try the nodes closest to where we enter the city until we find a route
+		starts := []image.Point{}
+		for _, n := range g.nodes {
+			if !c.onBorder(n) { // we'd rather not run along the border
+				starts = append(starts, n)
+			}
+		}
+		sort.SliceStable(starts, func(i, k int) bool {
+			return calculateDist(entry.X, entry.Y, starts[i].X, starts[i].Y) < calculateDist(entry.X, entry.Y, starts[k].X, starts[k].Y)
+		})
+		if len(starts) > maxExternalStarts {
+			starts = starts[:maxExternalStarts]
+		}
+
+		routed := false
+		for _, dest := range dests {
+			for _, start := range starts {
+				path, ok := g.path(start, dest.target)
+				if !ok {
+					continue
+				}
+				path = append([][2]image.Point{{entry, start}}, path...)
+				for _, r := range c.addRoadPath(append(path, dest.finish...), width, MainRoad) {
+					r.External = true
+				}
+				routed = true
+				break
+			}
+			if routed {
+				break
+			}
+		}
+		if !routed {
+			unrouted = append(unrouted, p)
+		}
+	}
+
+	return unrouted
+}
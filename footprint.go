@@ -0,0 +1,119 @@
+package citygraph
+
+import (
+	"image"
+	"math"
+)
+
+// Footprint is the shape of a building within it's Area, for buildings
+// that don't take up the whole rectangle (see BuildingConfig.Footprint)
+type Footprint struct {
+	// Mask has a row for each pixel down the Area & a value for each pixel
+	// across it, set where the building stands
+	Mask [][]bool
+}
+
+// Covers returns if the building stands at x,y, where x,y is relative to the
+// top left of the building's Area
+func (f *Footprint) Covers(x, y int) bool {
+	if y < 0 || y >= len(f.Mask) || x < 0 || x >= len(f.Mask[y]) {
+		return false
+	}
+	return f.Mask[y][x]
+}
+
+// PolygonFootprint returns the footprint of a building w by h pixels
+// outlined by the given polygon (relative to the top left of it's Area)
+func PolygonFootprint(w, h int, poly []image.Point) *Footprint {
+	return maskFootprint(w, h, func(x, y int) bool {
+		return inPolygon(float64(x)+0.5, float64(y)+0.5, poly)
+	})
+}
+
+// LFootprint returns an L shaped footprint w by h pixels, with arms
+// `thickness` pixels wide running down the left & along the bottom
+func LFootprint(w, h, thickness int) *Footprint {
+	return maskFootprint(w, h, func(x, y int) bool {
+		return x < thickness || y >= h-thickness
+	})
+}
+
+// UFootprint returns a U shaped footprint w by h pixels, with arms
+// `thickness` pixels wide around a courtyard that opens to the top
+func UFootprint(w, h, thickness int) *Footprint {
+	return maskFootprint(w, h, func(x, y int) bool {
+		return x < thickness || x >= w-thickness || y >= h-thickness
+	})
+}
+
+// CourtyardFootprint returns a footprint w by h pixels enclosing a courtyard,
+// with ranges `thickness` pixels wide on all four sides
+func CourtyardFootprint(w, h, thickness int) *Footprint {
+	return maskFootprint(w, h, func(x, y int) bool {
+		return x < thickness || x >= w-thickness || y < thickness || y >= h-thickness
+	})
+}
+
+// CrossFootprint returns a cross shaped footprint w by h pixels (ie. a
+// church), with arms `thickness` pixels wide crossing in the middle
+func CrossFootprint(w, h, thickness int) *Footprint {
+	return maskFootprint(w, h, func(x, y int) bool {
+		return (x >= (w-thickness)/2 && x < (w-thickness)/2+thickness) || (y >= (h-thickness)/2 && y < (h-thickness)/2+thickness)
+	})
+}
+
+// RoundFootprint returns a round (or oval) footprint w by h pixels (ie. a
+// tower house)
+func RoundFootprint(w, h int) *Footprint {
+	rx, ry := float64(w)/2, float64(h)/2
+	return maskFootprint(w, h, func(x, y int) bool {
+		dx, dy := (float64(x)+0.5-rx)/rx, (float64(y)+0.5-ry)/ry
+		return math.Hypot(dx, dy) <= 1
+	})
+}
+
+// maskFootprint returns a footprint w by h pixels covering the pixels
+// where `in` returns true
+func maskFootprint(w, h int, in func(x, y int) bool) *Footprint {
+	mask := make([][]bool, h)
+	for y := range mask {
+		mask[y] = make([]bool, w)
+		for x := range mask[y] {
+			mask[y][x] = in(x, y)
+		}
+	}
+	return &Footprint{Mask: mask}
+}
+
+// covers returns if the building stands at x,y (relative to the top left
+// corner the building is placed at, as with Area)
+func (b *BuildingConfig) covers(x, y int) bool {
+	if !image.Pt(x, y).In(b.Area) {
+		return false
+	}
+	if b.Footprint == nil {
+		return true
+	}
+	return b.Footprint.Covers(x-b.Area.Min.X, y-b.Area.Min.Y)
+}
+
+// buildingFootprints returns the footprint of each building placed in the
+// city that has one, by building ID
+func (c *Citygraph) buildingFootprints() map[int]*Footprint {
+	found := map[int]*Footprint{}
+	add := func(b *Building) {
+		if b != nil && b.Footprint != nil {
+			found[b.ID] = b.Footprint
+		}
+	}
+	for _, d := range c.Districts {
+		add(d.Central)
+		for _, b := range d.Buildings {
+			add(b)
+		}
+	}
+	for _, p := range c.Plazas {
+		add(p.Feature)
+	}
+	return found
+}
@@ -0,0 +1,124 @@
+package citygraph
+
+import (
+	"image"
+	"strings"
+	"testing"
+)
+
+// maskString returns the footprint as rows of '#' (covered) & '.' (not)
+func maskString(f *Footprint) string {
+	rows := []string{}
+	for _, row := range f.Mask {
+		s := ""
+		for _, v := range row {
+			if v {
+				s += "#"
+			} else {
+				s += "."
+			}
+		}
+		rows = append(rows, s)
+	}
+	return strings.Join(rows, "\n")
+}
+
+func TestFootprints(t *testing.T) {
+	cases := []struct {
+		name   string
+		f      *Footprint
+		expect []string
+	}{
+		{"L", LFootprint(4, 4, 1), []string{
+			"#...",
+			"#...",
+			"#...",
+			"####",
+		}},
+		{"U", UFootprint(5, 4, 1), []string{
+			"#...#",
+			"#...#",
+			"#...#",
+			"#####",
+		}},
+		{"Courtyard", CourtyardFootprint(5, 5, 2), []string{
+			"#####",
+			"#####",
+			"##.##",
+			"#####",
+			"#####",
+		}},
+		{"Cross", CrossFootprint(5, 5, 1), []string{
+			"..#..",
+			"..#..",
+			"#####",
+			"..#..",
+			"..#..",
+		}},
+		{"Round", RoundFootprint(5, 5), []string{
+			".###.",
+			"#####",
+			"#####",
+			"#####",
+			".###.",
+		}},
+		{"Polygon", PolygonFootprint(4, 4, []image.Point{{0, 0}, {4, 0}, {0, 4}}), []string{
+			"###.",
+			"##..",
+			"#...",
+			"....",
+		}},
+	}
+
+	for _, tc := range cases {
+		got := maskString(tc.f)
+		expect := strings.Join(tc.expect, "\n")
+		if got != expect {
+			t.Errorf("%s: expected\n%s\ngot\n%s", tc.name, expect, got)
+		}
+	}
+}
+
+func TestFootprintCovers(t *testing.T) {
+	f := LFootprint(3, 3, 1)
+
+	if !f.Covers(0, 0) || !f.Covers(2, 2) {
+		t.Errorf("expected the L to cover (0,0) & (2,2)")
+	}
+	if f.Covers(1, 1) {
+		t.Errorf("expected the L not to cover (1,1)")
+	}
+	for _, p := range []image.Point{{-1, 0}, {0, -1}, {3, 2}, {2, 3}} {
+		if f.Covers(p.X, p.Y) {
+			t.Errorf("expected nothing covered outside the mask at %v", p)
+		}
+	}
+}
+
+func TestBuildingConfigCovers(t *testing.T) {
+	b := &BuildingConfig{ID: 1, Area: image.Rect(1, 1, 4, 4)}
+	if !b.covers(1, 1) || !b.covers(3, 3) || b.covers(0, 0) || b.covers(4, 4) {
+		t.Errorf("expected a building without a footprint to cover it's Area")
+	}
+
+	b.Footprint = LFootprint(3, 3, 1)
+	if !b.covers(1, 1) || !b.covers(3, 3) {
+		t.Errorf("expected (1,1) & (3,3) covered, relative to the Area")
+	}
+	if b.covers(2, 2) {
+		t.Errorf("expected (2,2) (inside the L) not to be covered")
+	}
+}
+
+func TestSetBuildingFootprint(t *testing.T) {
+	m := newMap(image.Rect(0, 0, 10, 10))
+	b := &BuildingConfig{ID: 7, Area: image.Rect(0, 0, 5, 5), Footprint: CourtyardFootprint(5, 5, 1)}
+
+	m.setBuilding(2, 2, b)
+	if id, _ := m.BuildingID(2, 2); id != 7 {
+		t.Errorf("expected building 7 at (2,2), got %d", id)
+	}
+	if id, _ := m.BuildingID(4, 4); id != 0 {
+		t.Errorf("expected the courtyard at (4,4) left empty, got %d", id)
+	}
+}
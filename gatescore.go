@@ -0,0 +1,282 @@
+package citygraph
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/voidshard/citygraph/internal/line"
+	"github.com/voidshard/citygraph/internal/voronoi"
+)
+
+// weights of each part of a gate's score (see gateScorer)
+const (
+	gateSpreadWeight = 2.0
+	gateLandWeight   = 2.0
+	gateTowardWeight = 1.0
+	gateRoadsWeight  = 1.0
+	gatePocketWeight = 2.0
+
+	// we count this many main roads at most
+	gateMaxRoads = 3
+)
+
+// GateScore records why a gate was placed where it was (for debugging).
+// See Citygraph.GateScores
+type GateScore struct {
+	Gate   image.Rectangle // the gatehouse
+	Score  float64
+	Reason string
+}
+
+// gateScorer scores possible gate locations along a wall, so we can choose
+// the best of them. Gates score well when they're
+// - far from gates we've already chosen along this wall
+// - lead out to land (rather than, say, the sea)
+// - face toward where roads will come from (see wallSpec.toward)
+// - meet a number of main roads outside the wall
+// - open on to a pocket of districts we couldn't otherwise get to (inner rings)
+type gateScorer struct {
+	remaining []*gateLocation
+	chosen    []*gateLocation
+
+	// gates are considered well spread if they're this far apart
+	spacing float64
+
+	// parts of the score that don't depend on what we've chosen
+	land   map[*gateLocation]float64
+	roads  map[*gateLocation]int
+	toward map[*gateLocation][]float64 // per wallSpec.toward
+	pocket map[*gateLocation]int       // see pocketGates
+}
+
+// newGateScorer sets up scoring for the given gate locations along the wall
+// (as returned by cell.Circut) where `inside` holds the IDs of sites within.
+func (c *Citygraph) newGateScorer(gates []*gateLocation, wall [][2]image.Point, inside map[int]bool, spec wallSpec) *gateScorer {
+	perimeter := 0.0
+	seen := map[string]bool{}
+	for _, seg := range wall {
+		id := edgeID(seg[0], seg[1])
+		if !seen[id] {
+			seen[id] = true
+			perimeter += calculateDist(seg[0].X, seg[0].Y, seg[1].X, seg[1].Y)
+		}
+	}
+
+	s := &gateScorer{
+		remaining: append([]*gateLocation{}, gates...),
+		chosen:    []*gateLocation{},
+		spacing:   perimeter / float64(maxint(spec.maxGates, 1)),
+		land:      map[*gateLocation]float64{},
+		roads:     map[*gateLocation]int{},
+		toward:    map[*gateLocation][]float64{},
+		pocket:    map[*gateLocation]int{},
+	}
+
+	for _, g := range gates {
+		s.land[g] = c.gateLand(g)
+		s.roads[g] = gateRoads(g, inside)
+		if pg, ok := spec.pockets[g]; ok {
+			s.pocket[g] = pg
+		}
+	}
+
+	// for each place roads come from the nearest gate scores 1, the furthest 0
+	for i, t := range spec.toward {
+		lo, hi := math.Inf(1), math.Inf(-1)
+		dists := map[*gateLocation]float64{}
+		for _, g := range gates {
+			d := distToSegment(g.mid(), t[0], t[1])
+			dists[g] = d
+			lo, hi = math.Min(lo, d), math.Max(hi, d)
+		}
+		for _, g := range gates {
+			score := 1.0
+			if hi > lo {
+				score = 1 - (dists[g]-lo)/(hi-lo)
+			}
+			if i == 0 {
+				s.toward[g] = []float64{}
+			}
+			s.toward[g] = append(s.toward[g], score)
+		}
+	}
+
+	return s
+}
+
+// next returns the best scoring gate location we haven't yet tried (or nil)
+// which is scored against the gates chosen so far
+func (s *gateScorer) next() *gateLocation {
+	best := -1
+	bestScore := 0.0
+	for i, g := range s.remaining {
+		score, _ := s.score(g)
+		if best < 0 || score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+
+	g := s.remaining[best]
+	s.remaining = append(s.remaining[:best], s.remaining[best+1:]...)
+	g.score, g.reason = s.score(g)
+	return g
+}
+
+// choose records that we've placed a gate at g
+func (s *gateScorer) choose(g *gateLocation) {
+	s.chosen = append(s.chosen, g)
+}
+
+// score returns the score of g given the gates chosen so far & a reason
+// listing each part of the score
+func (s *gateScorer) score(g *gateLocation) (float64, string) {
+	spread := 1.0
+	if s.spacing > 0 {
+		for _, o := range s.chosen {
+			om, gm := o.mid(), g.mid()
+			spread = math.Min(spread, calculateDist(om.X, om.Y, gm.X, gm.Y)/s.spacing)
+		}
+	}
+
+	// we only count places roads come from that aren't served by a gate
+	// we've already chosen (at least as well as by g)
+	toward := 0.0
+	for i, t := range s.toward[g] {
+		served := false
+		for _, o := range s.chosen {
+			if s.toward[o][i] >= t {
+				served = true
+				break
+			}
+		}
+		if !served {
+			toward = math.Max(toward, t)
+		}
+	}
+
+	roads := minint(s.roads[g], gateMaxRoads)
+
+	// one gate per pocket is plenty
+	pocket := 0.0
+	if pg, ok := s.pocket[g]; ok {
+		pocket = 1
+		for _, o := range s.chosen {
+			if og, ok := s.pocket[o]; ok && og == pg {
+				pocket = 0
+			}
+		}
+	}
+
+	score := spread*gateSpreadWeight + s.land[g]*gateLandWeight + toward*gateTowardWeight
+	score += float64(roads) / gateMaxRoads * gateRoadsWeight
+	score += pocket * gatePocketWeight
+
+	reason := fmt.Sprintf("spread %.2f, land %.2f, toward %.2f, main roads %d", spread, s.land[g], toward, s.roads[g])
+	if pocket > 0 {
+		reason += ", opens on to pocket"
+	}
+	return score, reason
+}
+
+// gateLand returns the fraction of land (rather than water) in front of the
+// gate, looking out from the middle of the edge toward the outside site
+func (c *Citygraph) gateLand(g *gateLocation) float64 {
+	f := c.cfg.Fortifications
+	reach := 3 * maxint(f.GatehouseArea.Dx(), f.GatehouseArea.Dy())
+
+	mid := g.mid()
+	dx, dy, l := unitVector(mid, image.Pt(g.Out.X(), g.Out.Y()))
+	if l == 0 {
+		return 0
+	}
+	end := image.Pt(mid.X+int(dx*float64(reach)), mid.Y+int(dy*float64(reach)))
+
+	land, total := 0, 0
+	for _, p := range line.PointsBetween(mid, end) {
+		if !p.In(c.cfg.Area) {
+			continue
+		}
+		total++
+		if c.outline.CanBuildOn(p.X, p.Y) {
+			land++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(land) / float64(total)
+}
+
+// gateRoads returns how many main roads meet the gate's edge from outside the
+// wall. Main roads run along the edges between districts, so these are the
+// other edges of the outside site that share an end with the gate's edge.
+func gateRoads(g *gateLocation, inside map[int]bool) int {
+	count := 0
+	for _, n := range g.Out.Neighbours() {
+		if inside[n.Site.ID()] || n.Site.ID() == g.In.ID() {
+			continue // that's wall, not road
+		}
+		for _, e := range n.Edges {
+			if sharesEnd(e, g.Edge) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// sharesEnd returns if the edges a & b have an end in common
+func sharesEnd(a, b [2]image.Point) bool {
+	return a[0] == b[0] || a[0] == b[1] || a[1] == b[0] || a[1] == b[1]
+}
+
+// pocketGates returns those gate locations that open on to a group of
+// `outside` districts that isn't reachable from one of the `outerGates` of the
+// wall outside it (with an ID for the group). These groups are pockets walled
+// in between the rings & would otherwise only be reachable if we happen to put
+// a gate there.
+func (c *Citygraph) pocketGates(gates []*gateLocation, outside []*District, outerGates []*gateLocation) map[*gateLocation]int {
+	group := map[int]int{} // district id -> group
+	for _, d := range outside {
+		group[d.ID] = -1
+	}
+	groups := 0
+	for _, d := range outside {
+		if group[d.ID] >= 0 {
+			continue
+		}
+		queue := []voronoi.Site{c.graph.SiteByID(d.ID)}
+		group[d.ID] = groups
+		for len(queue) > 0 {
+			next := queue[0]
+			queue = queue[1:]
+			for _, n := range next.Neighbours() {
+				id := n.Site.ID()
+				if g, ok := group[id]; ok && g < 0 {
+					group[id] = groups
+					queue = append(queue, n.Site)
+				}
+			}
+		}
+		groups++
+	}
+
+	reachable := map[int]bool{}
+	for _, g := range outerGates {
+		if gid, ok := group[g.InDist.ID]; ok {
+			reachable[gid] = true
+		}
+	}
+
+	pockets := map[*gateLocation]int{}
+	for _, g := range gates {
+		if gid, ok := group[g.OutDist.ID]; ok && !reachable[gid] {
+			pockets[g] = gid
+		}
+	}
+	return pockets
+}
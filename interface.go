@@ -1,5 +1,10 @@
 package citygraph
 
+import (
+	"image"
+	"math/rand"
+)
+
 // Outline tells citygrapher roughly what is at a given location.
 // We only have three questions;
 // - can I build on it? (place roads, buildings, towers, gatehouses etc)
@@ -17,3 +22,64 @@ type Outline interface {
 	// alongside a river / sea but .. who knows.
 	SuitableDock(x, y int) bool
 }
+
+// FordOutline is an optional extension to Outline. If our Outline implements
+// it we may place fords over shallow water where we can't place a bridge
+// (see CrossingSettings).
+type FordOutline interface {
+	// true if the water at x,y is shallow enough to wade across
+	CanFord(x, y int) bool
+}
+
+// StreetNamer picks names for streets. Names don't have to be unique, but
+// we'll ask a few times for a name that isn't already in use.
+type StreetNamer interface {
+	// StreetName returns a name for a street of the given hierarchy that runs
+	// (mostly) through a district of the given type.
+	StreetName(district DistrictType, h RoadHierarchy, rng *rand.Rand) string
+}
+
+// PlacementStrategy decides where buildings go within a district (see
+// DistrictConfig.Placement). Strategies shipped with citygraph are in
+// placement.go.
+type PlacementStrategy interface {
+	// PlaceBuildings places buildings in a single district via the Placer
+	PlaceBuildings(p Placer, rng *rand.Rand)
+}
+
+// Placer is handed to a PlacementStrategy to place buildings in a district.
+type Placer interface {
+	// Bounds of the district
+	Bounds() image.Rectangle
+
+	// true if x,y is buildable land within the district
+	Contains(x, y int) bool
+
+	// the chance a building is placed at any given spot (see
+	// DistrictConfig.BuildingDensity)
+	Density() float64
+
+	// the width & height of the largest building(s) configured for the district
+	MaxBuildingSize() image.Point
+
+	// how many pixels x,y is from the nearest road (or alley, bridge, plaza
+	// etc) walking through the district, or -1 if we can't reach one
+	RoadDistance(x, y int) int
+
+	// buildings chosen from now on must be at least n pixels from any other
+	SetSpacing(n int)
+
+	// Choose returns a building that fits with it's top left at x,y (or nil
+	// if none do), respecting the district's building probabilities & counts.
+	// Nothing is placed or counted until the building is given to Place.
+	Choose(x, y int) *BuildingConfig
+
+	// Place building b with it's top left at x,y. We return false (& place
+	// nothing) if b is nil, doesn't fit there, would exceed it's
+	// MaxInDistrict or the district is Full.
+	Place(x, y int, b *BuildingConfig) bool
+
+	// Full returns true once the district holds as many buildings as it may
+	// (see DistrictConfig.MaxBuildings)
+	Full() bool
+}
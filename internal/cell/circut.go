@@ -3,6 +3,8 @@ package cell
 import (
 	"fmt"
 	"image"
+	"math"
+	"sort"
 
 	"github.com/voidshard/citygraph/internal/voronoi"
 )
@@ -104,3 +106,181 @@ func deletionMethod(bnds image.Rectangle, inside, outside []voronoi.Site) [][2]i
 
 	return wall
 }
+
+// Ring is an ordered loop of vertices, where the last vertex joins back up
+// with the first.
+type Ring struct {
+	Vertices []image.Point
+
+	// indexes of vertices where the stretch on to the next vertex wasn't
+	// one of the segments we were given (see Rings)
+	Open []int
+}
+
+// Rings orders the segments of a circut (as returned by Circut) into rings.
+// Rings run clockwise (as seen on the map, where Y increases downward).
+// Where rings touch at a vertex they're returned as separate rings.
+// Segments that don't form a loop (ie. where the circut runs up against
+// something that isn't "outside") are joined end to end, nearest first, into
+// a single ring with the joins listed in Ring.Open.
+func Rings(segments [][2]image.Point) []*Ring {
+	toEdgeID := func(a, b image.Point) string {
+		if b.X < a.X {
+			a, b = b, a
+		} else if a.X == b.X && b.Y < a.Y {
+			a, b = b, a
+		}
+		return fmt.Sprintf("%d,%d-%d,%d", a.X, a.Y, b.X, b.Y)
+	}
+
+	// the circut lists segments in both directions, so we dedupe as we go
+	neighbours := map[image.Point][]image.Point{}
+	seen := map[string]bool{}
+	for _, seg := range segments {
+		id := toEdgeID(seg[0], seg[1])
+		if seen[id] || seg[0] == seg[1] {
+			continue
+		}
+		seen[id] = true
+		neighbours[seg[0]] = append(neighbours[seg[0]], seg[1])
+		neighbours[seg[1]] = append(neighbours[seg[1]], seg[0])
+	}
+
+	// sort everything so that we're deterministic
+	less := func(a, b image.Point) bool {
+		if a.Y == b.Y {
+			return a.X < b.X
+		}
+		return a.Y < b.Y
+	}
+	verts := []image.Point{}
+	for v, nbrs := range neighbours {
+		verts = append(verts, v)
+		sort.Slice(nbrs, func(i, k int) bool { return less(nbrs[i], nbrs[k]) })
+	}
+	sort.Slice(verts, func(i, k int) bool { return less(verts[i], verts[k]) })
+
+	used := map[string]bool{}
+	nextFrom := func(v image.Point) (image.Point, bool) {
+		for _, n := range neighbours[v] {
+			if !used[toEdgeID(v, n)] {
+				used[toEdgeID(v, n)] = true
+				return n, true
+			}
+		}
+		return v, false
+	}
+
+	rings := []*Ring{}
+	chains := [][]image.Point{}
+	walk := func(start image.Point) {
+		path := []image.Point{start}
+		at := map[image.Point]int{start: 0}
+		for {
+			next, ok := nextFrom(path[len(path)-1])
+			if !ok {
+				break
+			}
+			i, visited := at[next]
+			if !visited {
+				at[next] = len(path)
+				path = append(path, next)
+				continue
+			}
+			// we've come back around; cut the loop out as a ring of it's own
+			loop := make([]image.Point, len(path)-i)
+			copy(loop, path[i:])
+			rings = append(rings, &Ring{Vertices: loop, Open: []int{}})
+			for _, p := range path[i+1:] {
+				delete(at, p)
+			}
+			path = path[:i+1]
+		}
+		if len(path) > 1 {
+			chains = append(chains, path)
+		}
+	}
+
+	// chains have to be walked from an end, so we start with those
+	for _, v := range verts {
+		if len(neighbours[v])%2 == 1 {
+			walk(v)
+		}
+	}
+	for _, v := range verts {
+		walk(v)
+	}
+
+	if len(chains) > 0 {
+		rings = append(rings, joinChains(chains))
+	}
+
+	for _, r := range rings {
+		if signedArea(r.Vertices) >= 0 {
+			continue
+		}
+		n := len(r.Vertices)
+		for i, k := 0, n-1; i < k; i, k = i+1, k-1 {
+			r.Vertices[i], r.Vertices[k] = r.Vertices[k], r.Vertices[i]
+		}
+		// the stretch from i to i+1 is now from n-2-i to n-1-i, except for
+		// the stretch from the last vertex back to the first
+		for j, i := range r.Open {
+			if i < n-1 {
+				r.Open[j] = n - 2 - i
+			}
+		}
+		sort.Ints(r.Open)
+	}
+
+	return rings
+}
+
+// joinChains joins the chains of vertices end to end (nearest first) into a
+// single ring
+func joinChains(chains [][]image.Point) *Ring {
+	dist := func(a, b image.Point) float64 {
+		return math.Hypot(float64(a.X-b.X), float64(a.Y-b.Y))
+	}
+
+	ring := &Ring{Vertices: chains[0], Open: []int{}}
+	rest := chains[1:]
+	for len(rest) > 0 {
+		tail := ring.Vertices[len(ring.Vertices)-1]
+		best, reverse, bestDist := 0, false, math.Inf(1)
+		for i, ch := range rest {
+			if d := dist(tail, ch[0]); d < bestDist {
+				best, reverse, bestDist = i, false, d
+			}
+			if d := dist(tail, ch[len(ch)-1]); d < bestDist {
+				best, reverse, bestDist = i, true, d
+			}
+		}
+
+		next := rest[best]
+		rest = append(rest[:best], rest[best+1:]...)
+		if reverse {
+			for i, k := 0, len(next)-1; i < k; i, k = i+1, k-1 {
+				next[i], next[k] = next[k], next[i]
+			}
+		}
+
+		ring.Open = append(ring.Open, len(ring.Vertices)-1)
+		ring.Vertices = append(ring.Vertices, next...)
+	}
+
+	// and back around to the start
+	ring.Open = append(ring.Open, len(ring.Vertices)-1)
+	return ring
+}
+
+// signedArea returns twice the area of the polygon, which is positive where
+// the polygon runs clockwise on the map (Y increasing downward)
+func signedArea(poly []image.Point) int {
+	area := 0
+	for i := range poly {
+		a, b := poly[i], poly[(i+1)%len(poly)]
+		area += a.X*b.Y - b.X*a.Y
+	}
+	return area
+}
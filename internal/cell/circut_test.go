@@ -0,0 +1,113 @@
+package cell
+
+import (
+	"image"
+	"testing"
+)
+
+// segmentSet returns the (undirected) segments as a set
+func segmentSet(segments [][2]image.Point) map[[2]image.Point]bool {
+	set := map[[2]image.Point]bool{}
+	for _, s := range segments {
+		set[s] = true
+		set[[2]image.Point{s[1], s[0]}] = true
+	}
+	return set
+}
+
+// checkRing checks that r runs clockwise & that exactly the stretches listed
+// in r.Open aren't in the given segments
+func checkRing(t *testing.T, r *Ring, segments [][2]image.Point) {
+	t.Helper()
+	if signedArea(r.Vertices) <= 0 {
+		t.Errorf("expected ring to run clockwise, got %v", r.Vertices)
+	}
+
+	open := map[int]bool{}
+	for _, i := range r.Open {
+		open[i] = true
+	}
+	set := segmentSet(segments)
+	n := len(r.Vertices)
+	for i := range r.Vertices {
+		s := [2]image.Point{r.Vertices[i], r.Vertices[(i+1)%n]}
+		if set[s] == open[i] {
+			t.Errorf("stretch %d %v given %v but open %v", i, s, set[s], open[i])
+		}
+	}
+}
+
+func TestRingsClockwise(t *testing.T) {
+	// a square given anti-clockwise (on the map), with each segment listed
+	// in both directions as Circut does
+	a, b, c, d := image.Pt(0, 0), image.Pt(0, 10), image.Pt(10, 10), image.Pt(10, 0)
+	segments := [][2]image.Point{{a, b}, {b, c}, {c, d}, {d, a}, {b, a}, {c, b}, {d, c}, {a, d}}
+
+	rings := Rings(segments)
+	if len(rings) != 1 {
+		t.Fatalf("expected 1 ring, got %d", len(rings))
+	}
+	if len(rings[0].Vertices) != 4 {
+		t.Errorf("expected 4 vertices, got %v", rings[0].Vertices)
+	}
+	if len(rings[0].Open) != 0 {
+		t.Errorf("expected a closed ring, got open %v", rings[0].Open)
+	}
+	checkRing(t, rings[0], segments)
+}
+
+func TestRingsTouching(t *testing.T) {
+	// two squares touching at (10,10)
+	segments := [][2]image.Point{
+		{{0, 0}, {10, 0}}, {{10, 0}, {10, 10}}, {{10, 10}, {0, 10}}, {{0, 10}, {0, 0}},
+		{{10, 10}, {20, 10}}, {{20, 10}, {20, 20}}, {{20, 20}, {10, 20}}, {{10, 20}, {10, 10}},
+	}
+
+	rings := Rings(segments)
+	if len(rings) != 2 {
+		t.Fatalf("expected 2 rings, got %d", len(rings))
+	}
+	for _, r := range rings {
+		if len(r.Vertices) != 4 || len(r.Open) != 0 {
+			t.Errorf("expected a closed ring of 4 vertices, got %v open %v", r.Vertices, r.Open)
+		}
+		checkRing(t, r, segments)
+	}
+}
+
+func TestRingsOpen(t *testing.T) {
+	// a square missing it's top, given so that the joined ring runs
+	// anti-clockwise & must be reversed
+	segments := [][2]image.Point{
+		{{0, 0}, {0, 10}}, {{0, 10}, {10, 10}}, {{10, 10}, {10, 0}},
+	}
+
+	rings := Rings(segments)
+	if len(rings) != 1 {
+		t.Fatalf("expected 1 ring, got %d", len(rings))
+	}
+	if len(rings[0].Open) != 1 {
+		t.Fatalf("expected 1 open stretch, got %v", rings[0].Open)
+	}
+	checkRing(t, rings[0], segments)
+}
+
+func TestRingsOpenChains(t *testing.T) {
+	// two separate runs, either side of a square
+	segments := [][2]image.Point{
+		{{0, 0}, {0, 5}}, {{0, 5}, {0, 10}},
+		{{10, 10}, {10, 5}}, {{10, 5}, {10, 0}},
+	}
+
+	rings := Rings(segments)
+	if len(rings) != 1 {
+		t.Fatalf("expected 1 ring, got %d", len(rings))
+	}
+	if len(rings[0].Vertices) != 6 {
+		t.Errorf("expected 6 vertices, got %v", rings[0].Vertices)
+	}
+	if len(rings[0].Open) != 2 {
+		t.Fatalf("expected 2 open stretches, got %v", rings[0].Open)
+	}
+	checkRing(t, rings[0], segments)
+}
@@ -0,0 +1,181 @@
+package citygraph
+
+import (
+	"image"
+	"math"
+
+	"github.com/voidshard/citygraph/internal/line"
+)
+
+// addMoat digs a moat `moat` pixels wide along the outside face of the given
+// wall (of the given width), where `inside` holds the IDs of the sites within
+// the wall. The moat is only dug on land; towers, gatehouses & the like stand
+// in it. Roads may only cross the moat in front of the given gates.
+// We return the band of moat along each section of wall.
+func (c *Citygraph) addMoat(wall [][2]image.Point, inside map[int]bool, gates map[string]*gateLocation, width, moat int) [][]image.Point {
+	near := float64(width) / 2
+	far := near + float64(moat)
+	pt := func(x, y float64) image.Point {
+		return image.Pt(int(math.Round(x)), int(math.Round(y)))
+	}
+
+	// in front of a gate the moat is left open to roads (which we later
+	// bridge, see addDrawbridges)
+	inFront := func(p image.Point) bool {
+		for _, g := range gates {
+			front := image.Pt((g.Left.X+g.Right.X)/2, (g.Left.Y+g.Right.Y)/2)
+			radius := math.Max(calculateDist(g.Left.X, g.Left.Y, g.Right.X, g.Right.Y)/2, far+2)
+			if calculateDist(p.X, p.Y, front.X, front.Y) <= radius {
+				return true
+			}
+		}
+		return false
+	}
+
+	seen := map[string]bool{}
+	bands := [][]image.Point{}
+	for _, seg := range wall {
+		id := edgeID(seg[0], seg[1])
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		ux, uy, l := unitVector(seg[0], seg[1])
+		if l == 0 {
+			continue
+		}
+
+		// work out which side of the wall is outside
+		nx, ny := -uy, ux
+		mx, my := float64(seg[0].X+seg[1].X)/2, float64(seg[0].Y+seg[1].Y)/2
+		test := pt(mx+nx*far, my+ny*far)
+		if inside[c.graph.SiteFor(test.X, test.Y).ID()] {
+			nx, ny = -nx, -ny
+		}
+
+		// extended along the wall so that the moat is unbroken around corners
+		ax, ay := float64(seg[0].X)-ux*far, float64(seg[0].Y)-uy*far
+		bx, by := float64(seg[1].X)+ux*far, float64(seg[1].Y)+uy*far
+		band := []image.Point{
+			pt(ax+nx*near, ay+ny*near),
+			pt(bx+nx*near, by+ny*near),
+			pt(bx+nx*far, by+ny*far),
+			pt(ax+nx*far, ay+ny*far),
+		}
+
+		dug := 0
+		for _, p := range polygonPixels(band) {
+			if !p.In(c.cfg.Area) || !c.outline.CanBuildOn(p.X, p.Y) {
+				continue
+			}
+			if inside[c.graph.SiteFor(p.X, p.Y).ID()] {
+				continue // the inside of a corner
+			}
+			c.cmap.markArea(image.Rect(p.X, p.Y, p.X+1, p.Y+1), featureMoat)
+			if !inFront(p) {
+				c.cmap.protect(p.X, p.Y)
+			}
+			dug++
+		}
+		if dug > 0 {
+			bands = append(bands, band)
+		}
+	}
+
+	return bands
+}
+
+// moatBeside returns if there is a moat running along the side of (a,b)
+// given by the sign of dist (as offsetLine), within dist of the line
+func (c *Citygraph) moatBeside(a, b image.Point, dist int) bool {
+	ux, uy, l := unitVector(a, b)
+	if l == 0 {
+		return false
+	}
+	nx, ny := -uy*float64(dist), ux*float64(dist)
+	for _, t := range []float64{0.25, 0.5, 0.75} {
+		x := float64(a.X) + ux*l*t
+		y := float64(a.Y) + uy*l*t
+		// step out from the wall, since towers & such aren't moat
+		for s := 0.25; s <= 1; s += 0.25 {
+			p := image.Pt(int(math.Round(x+nx*s)), int(math.Round(y+ny*s)))
+			if c.cmap.hasFeature(p.X, p.Y, featureMoat) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// addDrawbridges turns roads into drawbridges (see DrawbridgeSection) where
+// they cross a moat, which they can only do in front of a gate.
+// Must be called after all roads are drawn & before endDraw.
+func (c *Citygraph) addDrawbridges() {
+	for _, r := range c.RoadNetwork.Roads {
+		sections := []*Section{}
+		for _, s := range r.Sections {
+			if s.Bridge || s.Kind != "" {
+				sections = append(sections, s)
+				continue
+			}
+
+			pieces := c.splitAtMoat(s)
+			for _, piece := range pieces {
+				if !piece.Bridge {
+					continue
+				}
+				piece.Kind = DrawbridgeSection
+				c.cmap.drawBridge(piece.Path[0], piece.Path[1], r.Width)
+				r.Bridges++
+				c.countBridge(piece.Path)
+			}
+			sections = append(sections, pieces...)
+		}
+		r.Sections = sections
+	}
+}
+
+// splitAtMoat breaks the section into pieces of road & bridge (where it
+// crosses a moat). The section is returned as is if it doesn't cross a moat.
+func (c *Citygraph) splitAtMoat(s *Section) []*Section {
+	pnts := []image.Point{}
+	for _, l := range s.lines() {
+		for _, o := range orthogonalise(l[0], l[1], c.cfg.RoadMode) {
+			between := line.PointsBetween(o[0], o[1])
+			if len(between) > 0 && between[0] != o[0] {
+				for i, k := 0, len(between)-1; i < k; i, k = i+1, k-1 {
+					between[i], between[k] = between[k], between[i]
+				}
+			}
+			if len(pnts) > 0 && len(between) > 0 && pnts[len(pnts)-1] == between[0] {
+				between = between[1:]
+			}
+			pnts = append(pnts, between...)
+		}
+	}
+
+	// nb. the moat is protected (so not drawn on) other than in front of gates
+	isMoat := func(p image.Point) bool {
+		return c.cmap.hasFeature(p.X, p.Y, featureMoat) && !c.cmap.isProtected(p.X, p.Y)
+	}
+
+	pieces := []*Section{}
+	start := 0
+	for i := 1; i <= len(pnts); i++ {
+		if i < len(pnts) && isMoat(pnts[i]) == isMoat(pnts[start]) {
+			continue
+		}
+		piece := &Section{Path: [2]image.Point{pnts[start], pnts[i-1]}, Bridge: isMoat(pnts[start])}
+		if len(s.Curve) > 0 && !piece.Bridge {
+			piece.Curve = pnts[start:i]
+		}
+		pieces = append(pieces, piece)
+		start = i
+	}
+
+	if len(pieces) < 2 && (len(pieces) == 0 || !pieces[0].Bridge) {
+		return []*Section{s}
+	}
+	return pieces
+}
@@ -0,0 +1,115 @@
+package citygraph
+
+import (
+	"image"
+)
+
+// RoadMode determines how roads (and walls) are laid out between two points
+type RoadMode string
+
+const (
+	DiagonalRoads  RoadMode = ""          // straight lines, drawn as they fall (default)
+	StaircaseRoads RoadMode = "staircase" // axis aligned steps that follow the line
+	DoglegRoads    RoadMode = "dogleg"    // a single "L" shaped bend
+)
+
+// staircaseStep is roughly how long (in pixels) each step of a staircase is
+const staircaseStep = 8
+
+// orthogonalise breaks the line (a,b) into axis aligned lines according to
+// the RoadMode. The lines are returned in order from a to b. Lines that are
+// already axis aligned (or any line, for DiagonalRoads) are returned as is.
+func orthogonalise(a, b image.Point, mode RoadMode) [][2]image.Point {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	if mode == DiagonalRoads || dx == 0 || dy == 0 {
+		return [][2]image.Point{{a, b}}
+	}
+
+	steps := 1
+	if mode == StaircaseRoads {
+		major, minor := absint(dx), absint(dy)
+		if minor > major {
+			major, minor = minor, major
+		}
+		steps = major / staircaseStep
+		if steps > minor {
+			steps = minor // each step must move at least 1 pixel
+		}
+		if steps < 1 {
+			steps = 1
+		}
+	}
+
+	// we move along the major axis first, then across
+	horizontal := absint(dx) >= absint(dy)
+
+	lines := [][2]image.Point{}
+	add := func(p, q image.Point) {
+		if p == q {
+			return
+		}
+		if len(lines) > 0 {
+			last := lines[len(lines)-1]
+			if (last[0].X == q.X && p.X == q.X) || (last[0].Y == q.Y && p.Y == q.Y) {
+				lines[len(lines)-1][1] = q // carries straight on
+				return
+			}
+		}
+		lines = append(lines, [2]image.Point{p, q})
+	}
+
+	current := a
+	for i := 1; i <= steps; i++ {
+		next := image.Pt(a.X+dx*i/steps, a.Y+dy*i/steps)
+		corner := image.Pt(next.X, current.Y)
+		if !horizontal {
+			corner = image.Pt(current.X, next.Y)
+		}
+		add(current, corner)
+		add(corner, next)
+		current = next
+	}
+
+	return lines
+}
+
+// orthogonalPoints returns every pixel along the given (axis aligned,
+// connected) lines in order along with the indexes of the pixels where the
+// path turns a corner.
+func orthogonalPoints(lines [][2]image.Point) ([]image.Point, map[int]bool) {
+	points := []image.Point{}
+	corners := map[int]bool{}
+
+	for i, l := range lines {
+		step := image.Pt(sign(l[1].X-l[0].X), sign(l[1].Y-l[0].Y))
+		p := l[0]
+		if i > 0 {
+			corners[len(points)-1] = true
+			p = p.Add(step) // the first pixel is the end of the last line
+		}
+		for {
+			points = append(points, p)
+			if p == l[1] {
+				break
+			}
+			p = p.Add(step)
+		}
+	}
+
+	return points, corners
+}
+
+// sign returns -1, 0 or 1 for negative, zero & positive numbers
+func sign(a int) int {
+	if a < 0 {
+		return -1
+	} else if a > 0 {
+		return 1
+	}
+	return 0
+}
+
+// isAxisAligned returns if the line runs straight along the x or y axis
+func isAxisAligned(l [2]image.Point) bool {
+	return l[0].X == l[1].X || l[0].Y == l[1].Y
+}
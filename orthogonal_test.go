@@ -0,0 +1,104 @@
+package citygraph
+
+import (
+	"image"
+	"reflect"
+	"testing"
+)
+
+func TestOrthogonalise(t *testing.T) {
+	cases := []struct {
+		name   string
+		a, b   image.Point
+		mode   RoadMode
+		expect int // number of lines
+	}{
+		{"diagonal mode", image.Pt(0, 0), image.Pt(30, 20), DiagonalRoads, 1},
+		{"zero length", image.Pt(5, 5), image.Pt(5, 5), StaircaseRoads, 1},
+		{"horizontal", image.Pt(0, 5), image.Pt(30, 5), StaircaseRoads, 1},
+		{"vertical", image.Pt(5, 30), image.Pt(5, 0), DoglegRoads, 1},
+		{"dogleg", image.Pt(0, 0), image.Pt(30, 20), DoglegRoads, 2},
+		{"dogleg mostly vertical", image.Pt(0, 0), image.Pt(-4, 30), DoglegRoads, 2},
+		{"staircase", image.Pt(0, 0), image.Pt(16, 16), StaircaseRoads, 4},
+		{"staircase too short to step", image.Pt(0, 0), image.Pt(5, 3), StaircaseRoads, 2},
+		{"staircase steps limited by minor axis", image.Pt(0, 0), image.Pt(80, 3), StaircaseRoads, 6},
+		{"staircase backwards", image.Pt(40, 40), image.Pt(0, 8), StaircaseRoads, 10},
+	}
+	for _, tc := range cases {
+		lines := orthogonalise(tc.a, tc.b, tc.mode)
+
+		if len(lines) != tc.expect {
+			t.Errorf("%s: expected %d lines, got %d %v", tc.name, tc.expect, len(lines), lines)
+		}
+		if len(lines) == 0 || lines[0][0] != tc.a || lines[len(lines)-1][1] != tc.b {
+			t.Errorf("%s: expected lines from %v to %v, got %v", tc.name, tc.a, tc.b, lines)
+			continue
+		}
+		if tc.mode == DiagonalRoads {
+			continue
+		}
+
+		for i, l := range lines {
+			if l[0].X != l[1].X && l[0].Y != l[1].Y {
+				t.Errorf("%s: expected axis aligned lines, got %v", tc.name, l)
+			}
+			if i == 0 {
+				continue
+			}
+			last := lines[i-1]
+			if last[1] != l[0] {
+				t.Errorf("%s: expected connected lines, got %v then %v", tc.name, last, l)
+			}
+			if (last[0].X == l[1].X && l[0].X == l[1].X) || (last[0].Y == l[1].Y && l[0].Y == l[1].Y) {
+				t.Errorf("%s: expected collinear lines to be merged, got %v then %v", tc.name, last, l)
+			}
+		}
+	}
+}
+
+func TestOrthogonalPoints(t *testing.T) {
+	cases := []struct {
+		name    string
+		lines   [][2]image.Point
+		points  []image.Point
+		corners map[int]bool
+	}{
+		{
+			"single pixel",
+			[][2]image.Point{{image.Pt(1, 1), image.Pt(1, 1)}},
+			[]image.Point{image.Pt(1, 1)},
+			map[int]bool{},
+		},
+		{
+			"straight",
+			[][2]image.Point{{image.Pt(3, 0), image.Pt(0, 0)}},
+			[]image.Point{image.Pt(3, 0), image.Pt(2, 0), image.Pt(1, 0), image.Pt(0, 0)},
+			map[int]bool{},
+		},
+		{
+			"one corner",
+			[][2]image.Point{{image.Pt(0, 0), image.Pt(2, 0)}, {image.Pt(2, 0), image.Pt(2, 2)}},
+			[]image.Point{image.Pt(0, 0), image.Pt(1, 0), image.Pt(2, 0), image.Pt(2, 1), image.Pt(2, 2)},
+			map[int]bool{2: true},
+		},
+		{
+			"steps",
+			[][2]image.Point{
+				{image.Pt(0, 0), image.Pt(1, 0)},
+				{image.Pt(1, 0), image.Pt(1, 1)},
+				{image.Pt(1, 1), image.Pt(2, 1)},
+			},
+			[]image.Point{image.Pt(0, 0), image.Pt(1, 0), image.Pt(1, 1), image.Pt(2, 1)},
+			map[int]bool{1: true, 2: true},
+		},
+	}
+	for _, tc := range cases {
+		points, corners := orthogonalPoints(tc.lines)
+		if !reflect.DeepEqual(points, tc.points) {
+			t.Errorf("%s: expected points %v, got %v", tc.name, tc.points, points)
+		}
+		if !reflect.DeepEqual(corners, tc.corners) {
+			t.Errorf("%s: expected corners %v, got %v", tc.name, tc.corners, corners)
+		}
+	}
+}
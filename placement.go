@@ -0,0 +1,281 @@
+package citygraph
+
+import (
+	"image"
+	"math/rand"
+	"sort"
+)
+
+// SpiralPlacement places buildings by running around the outside of the
+// district in rings, spiralling inwards towards the centre. This makes
+// buildings appear to hug the edges / roads a fair bit. This is the default.
+type SpiralPlacement struct{}
+
+// PlaceBuildings see PlacementStrategy
+func (s *SpiralPlacement) PlaceBuildings(p Placer, rng *rand.Rand) {
+	bnds := p.Bounds()
+	dx := bnds.Max.X - bnds.Min.X
+	dy := bnds.Max.Y - bnds.Min.Y
+	ilimit := dx
+	if dy < dx {
+		ilimit = dy
+	}
+	for i := 0; i < ilimit/2; i++ { // spiral inward by i going along four edges
+		for x := bnds.Min.X + i; x < bnds.Max.X-i; x++ {
+			if rng.Float64() < p.Density() && !placeChosen(p, x, bnds.Min.Y+i) {
+				return
+			}
+			if rng.Float64() < p.Density() && !placeChosen(p, x, bnds.Max.Y-1-i) {
+				return
+			}
+		}
+
+		for y := bnds.Min.Y + i; y < bnds.Max.Y-i; y++ {
+			if rng.Float64() < p.Density() && !placeChosen(p, bnds.Min.X+i, y) {
+				return
+			}
+			if rng.Float64() < p.Density() && !placeChosen(p, bnds.Max.X-1-i, y) {
+				return
+			}
+		}
+	}
+}
+
+// placeChosen places the building the Placer chooses for x,y (if any),
+// returning false once the district is full
+func placeChosen(p Placer, x, y int) bool {
+	p.Place(x, y, p.Choose(x, y))
+	return !p.Full()
+}
+
+// PerimeterPlacement packs buildings along the edges of each block, placing
+// buildings nearest the roads first so that they hug the roads & leave the
+// middle of each block (yards, gardens ..) for last.
+type PerimeterPlacement struct {
+	// only place buildings within this many pixels of a road, 0 or less
+	// implies "anywhere"
+	Depth int
+}
+
+// PlaceBuildings see PlacementStrategy
+func (s *PerimeterPlacement) PlaceBuildings(p Placer, rng *rand.Rand) {
+	bnds := p.Bounds()
+	spots := []image.Point{}
+	for y := bnds.Min.Y; y < bnds.Max.Y; y++ {
+		for x := bnds.Min.X; x < bnds.Max.X; x++ {
+			dist := p.RoadDistance(x, y)
+			if dist < 0 || (s.Depth > 0 && dist > s.Depth) || !p.Contains(x, y) {
+				continue
+			}
+			spots = append(spots, image.Pt(x, y))
+		}
+	}
+	sort.SliceStable(spots, func(i, j int) bool {
+		return p.RoadDistance(spots[i].X, spots[i].Y) < p.RoadDistance(spots[j].X, spots[j].Y)
+	})
+
+	for _, pnt := range spots {
+		if rng.Float64() < p.Density() && !placeChosen(p, pnt.X, pnt.Y) {
+			return
+		}
+	}
+}
+
+// GridPlacement divides the district into regular lots & places (at most)
+// one building in each, as near the top left of the lot as it fits.
+type GridPlacement struct {
+	// size of each lot, the largest building in the district if not set
+	Lot image.Point
+
+	// space left between lots (ie. lanes or gardens)
+	Gap int
+}
+
+// PlaceBuildings see PlacementStrategy
+func (s *GridPlacement) PlaceBuildings(p Placer, rng *rand.Rand) {
+	lot := s.Lot
+	if lot.X <= 0 || lot.Y <= 0 {
+		lot = p.MaxBuildingSize()
+	}
+	if lot.X <= 0 || lot.Y <= 0 {
+		return
+	}
+
+	bnds := p.Bounds()
+	for ly := bnds.Min.Y; ly < bnds.Max.Y; ly += lot.Y + s.Gap {
+		for lx := bnds.Min.X; lx < bnds.Max.X; lx += lot.X + s.Gap {
+			if rng.Float64() >= p.Density() {
+				continue
+			}
+		lot:
+			for y := ly; y < ly+lot.Y && y < bnds.Max.Y; y++ {
+				for x := lx; x < lx+lot.X && x < bnds.Max.X; x++ {
+					if !p.Contains(x, y) {
+						continue
+					}
+					if !p.Place(x, y, p.Choose(x, y)) {
+						continue
+					}
+					if p.Full() {
+						return
+					}
+					break lot
+				}
+			}
+		}
+	}
+}
+
+// ScatterPlacement drops buildings at random spots across the district,
+// keeping them at least Spacing pixels apart (ie. villas, parks, farms).
+type ScatterPlacement struct {
+	// min distance between buildings
+	Spacing int
+
+	// number of random spots we try, if not set we try enough to (about)
+	// cover the district with the largest building four times over
+	Attempts int
+}
+
+// PlaceBuildings see PlacementStrategy
+func (s *ScatterPlacement) PlaceBuildings(p Placer, rng *rand.Rand) {
+	bnds := p.Bounds()
+	if bnds.Empty() {
+		return
+	}
+
+	attempts := s.Attempts
+	if attempts <= 0 {
+		size := p.MaxBuildingSize()
+		attempts = 4 * bnds.Dx() * bnds.Dy() / maxint(1, size.X*size.Y)
+	}
+
+	p.SetSpacing(s.Spacing)
+	for i := 0; i < attempts; i++ {
+		x, y := bnds.Min.X+rng.Intn(bnds.Dx()), bnds.Min.Y+rng.Intn(bnds.Dy())
+		if !p.Contains(x, y) || rng.Float64() >= p.Density() {
+			continue
+		}
+		if !placeChosen(p, x, y) {
+			return
+		}
+	}
+}
+
+// districtPlacer is the Placer given to a PlacementStrategy
+type districtPlacer struct {
+	*districtBuilder
+	cmap   *imageMap
+	bounds image.Rectangle
+
+	// distance from each pixel in bounds to the nearest road, worked out
+	// the first time we're asked (see RoadDistance)
+	roadDist []int
+}
+
+// newDistrictPlacer returns a Placer for the district being built by db
+func newDistrictPlacer(db *districtBuilder, m *imageMap) *districtPlacer {
+	return &districtPlacer{districtBuilder: db, cmap: m, bounds: db.site.Bounds()}
+}
+
+// Bounds see Placer
+func (p *districtPlacer) Bounds() image.Rectangle {
+	return p.bounds
+}
+
+// Contains see Placer
+func (p *districtPlacer) Contains(x, y int) bool {
+	return p.outline.CanBuildOn(x, y) && p.site.Contains(x, y)
+}
+
+// Density see Placer
+func (p *districtPlacer) Density() float64 {
+	return p.cfg.BuildingDensity
+}
+
+// MaxBuildingSize see Placer
+func (p *districtPlacer) MaxBuildingSize() image.Point {
+	size := image.Point{}
+	for _, b := range p.cfg.Buildings {
+		size.X = maxint(size.X, b.Area.Dx())
+		size.Y = maxint(size.Y, b.Area.Dy())
+	}
+	return size
+}
+
+// RoadDistance see Placer
+func (p *districtPlacer) RoadDistance(x, y int) int {
+	if !image.Pt(x, y).In(p.bounds) {
+		return -1
+	}
+	if p.roadDist == nil {
+		p.roadDist = p.roadDistances()
+	}
+	return p.roadDist[(y-p.bounds.Min.Y)*p.bounds.Dx()+x-p.bounds.Min.X]
+}
+
+// roadDistances walks out from every road pixel in the district (breadth
+// first) to work out how far each pixel is from a road
+func (p *districtPlacer) roadDistances() []int {
+	w := p.bounds.Dx()
+	dist := make([]int, w*p.bounds.Dy())
+	queue := []image.Point{}
+	for y := p.bounds.Min.Y; y < p.bounds.Max.Y; y++ {
+		for x := p.bounds.Min.X; x < p.bounds.Max.X; x++ {
+			i := (y-p.bounds.Min.Y)*w + x - p.bounds.Min.X
+			if p.cm.IsRoad(x, y) || p.cm.IsBridge(x, y) || p.cm.IsAlley(x, y) || p.cm.IsPlaza(x, y) || p.cm.IsFord(x, y) || p.cm.IsFerry(x, y) {
+				queue = append(queue, image.Pt(x, y))
+				continue
+			}
+			dist[i] = -1
+		}
+	}
+
+	for len(queue) > 0 {
+		q := queue[0]
+		queue = queue[1:]
+		d := dist[(q.Y-p.bounds.Min.Y)*w+q.X-p.bounds.Min.X]
+		for _, n := range []image.Point{{q.X + 1, q.Y}, {q.X - 1, q.Y}, {q.X, q.Y + 1}, {q.X, q.Y - 1}} {
+			if !n.In(p.bounds) || !p.Contains(n.X, n.Y) {
+				continue
+			}
+			i := (n.Y-p.bounds.Min.Y)*w + n.X - p.bounds.Min.X
+			if dist[i] >= 0 {
+				continue
+			}
+			dist[i] = d + 1
+			queue = append(queue, n)
+		}
+	}
+
+	return dist
+}
+
+// SetSpacing see Placer
+func (p *districtPlacer) SetSpacing(n int) {
+	p.spacing = n
+}
+
+// Choose see Placer
+func (p *districtPlacer) Choose(x, y int) *BuildingConfig {
+	return p.chooseBuilding(x, y)
+}
+
+// Place see Placer
+func (p *districtPlacer) Place(x, y int, b *BuildingConfig) bool {
+	if b == nil || p.Full() || !p.buildingFits(x, y, b) {
+		return false
+	}
+	if b.MaxInDistrict > 0 && p.count[b.ID] >= b.MaxInDistrict {
+		return false
+	}
+	p.placedBuilding(b)
+	p.cmap.setBuilding(x, y, b)
+	p.d.addBuilding(x, y, b)
+	return true
+}
+
+// Full see Placer
+func (p *districtPlacer) Full() bool {
+	return p.cfg.MaxBuildings > 0 && len(p.d.Buildings) >= p.cfg.MaxBuildings
+}
@@ -0,0 +1,195 @@
+package citygraph
+
+import (
+	"image"
+	"math/rand"
+	"testing"
+)
+
+// testPlacer is a Placer over an empty district with a road running down
+// it's left hand side, placing 2x2 buildings
+type testPlacer struct {
+	t       *testing.T
+	bounds  image.Rectangle
+	max     int
+	spacing int
+
+	building *BuildingConfig
+	taken    map[image.Point]bool
+	placed   []image.Point
+	chosen   *image.Point
+}
+
+func newTestPlacer(t *testing.T, w, h, max int) *testPlacer {
+	return &testPlacer{
+		t:        t,
+		bounds:   image.Rect(0, 0, w, h),
+		max:      max,
+		building: &BuildingConfig{ID: 1, Area: image.Rect(0, 0, 2, 2)},
+		taken:    map[image.Point]bool{},
+	}
+}
+
+func (p *testPlacer) Bounds() image.Rectangle { return p.bounds }
+func (p *testPlacer) Contains(x, y int) bool  { return image.Pt(x, y).In(p.bounds) }
+func (p *testPlacer) Density() float64        { return 1 }
+func (p *testPlacer) SetSpacing(n int)        { p.spacing = n }
+func (p *testPlacer) Full() bool              { return p.max > 0 && len(p.placed) >= p.max }
+
+func (p *testPlacer) MaxBuildingSize() image.Point {
+	return p.building.Area.Size()
+}
+
+func (p *testPlacer) RoadDistance(x, y int) int {
+	if !p.Contains(x, y) {
+		return -1
+	}
+	return x + 1
+}
+
+func (p *testPlacer) fits(x, y int) bool {
+	for dy := -p.spacing; dy < 2+p.spacing; dy++ {
+		for dx := -p.spacing; dx < 2+p.spacing; dx++ {
+			q := image.Pt(x+dx, y+dy)
+			if p.taken[q] {
+				return false
+			}
+			if dx >= 0 && dx < 2 && dy >= 0 && dy < 2 && !p.Contains(q.X, q.Y) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (p *testPlacer) Choose(x, y int) *BuildingConfig {
+	p.chosen = &image.Point{x, y}
+	if !p.fits(x, y) {
+		return nil
+	}
+	return p.building
+}
+
+func (p *testPlacer) Place(x, y int, b *BuildingConfig) bool {
+	if b != nil && (p.chosen == nil || *p.chosen != image.Pt(x, y)) {
+		p.t.Errorf("placing at (%d,%d) but chose at %v", x, y, p.chosen)
+	}
+	if b == nil || p.Full() || !p.fits(x, y) {
+		return false
+	}
+	for dy := 0; dy < 2; dy++ {
+		for dx := 0; dx < 2; dx++ {
+			p.taken[image.Pt(x+dx, y+dy)] = true
+		}
+	}
+	p.placed = append(p.placed, image.Pt(x, y))
+	return true
+}
+
+// checkPlaced checks nothing was placed overlapping or outside the district
+func (p *testPlacer) checkPlaced() {
+	p.t.Helper()
+	if len(p.placed) == 0 {
+		p.t.Errorf("expected buildings to be placed")
+	}
+	if len(p.taken) != 4*len(p.placed) {
+		p.t.Errorf("expected %d pixels taken by %d buildings, got %d", 4*len(p.placed), len(p.placed), len(p.taken))
+	}
+	for q := range p.taken {
+		if !p.Contains(q.X, q.Y) {
+			p.t.Errorf("expected buildings within the district, got %v", q)
+		}
+	}
+}
+
+func TestPlacementStrategies(t *testing.T) {
+	strategies := map[string]PlacementStrategy{
+		"spiral":    &SpiralPlacement{},
+		"perimeter": &PerimeterPlacement{},
+		"grid":      &GridPlacement{Gap: 1},
+		"scatter":   &ScatterPlacement{Spacing: 1},
+	}
+	for name, s := range strategies {
+		t.Run(name, func(t *testing.T) {
+			p := newTestPlacer(t, 12, 12, 0)
+			s.PlaceBuildings(p, rand.New(rand.NewSource(1)))
+			p.checkPlaced()
+		})
+	}
+}
+
+func TestPlacementStopsWhenFull(t *testing.T) {
+	strategies := map[string]PlacementStrategy{
+		"spiral":    &SpiralPlacement{},
+		"perimeter": &PerimeterPlacement{},
+		"grid":      &GridPlacement{},
+		"scatter":   &ScatterPlacement{},
+	}
+	for name, s := range strategies {
+		p := newTestPlacer(t, 12, 12, 3)
+		s.PlaceBuildings(p, rand.New(rand.NewSource(1)))
+		if len(p.placed) != 3 {
+			t.Errorf("%s: expected 3 buildings placed, got %d", name, len(p.placed))
+		}
+	}
+}
+
+func TestSpiralPlacementEdges(t *testing.T) {
+	p := newTestPlacer(t, 8, 8, 0)
+	(&SpiralPlacement{}).PlaceBuildings(p, rand.New(rand.NewSource(1)))
+	p.checkPlaced()
+
+	// the first ring runs around the edges, so fills all four corners
+	for _, q := range []image.Point{{0, 0}, {7, 0}, {0, 7}, {7, 7}} {
+		if !p.taken[q] {
+			t.Errorf("expected corner %v built on", q)
+		}
+	}
+}
+
+func TestPerimeterPlacementDepth(t *testing.T) {
+	p := newTestPlacer(t, 12, 12, 0)
+	(&PerimeterPlacement{Depth: 4}).PlaceBuildings(p, rand.New(rand.NewSource(1)))
+	p.checkPlaced()
+
+	for _, q := range p.placed {
+		if p.RoadDistance(q.X, q.Y) > 4 {
+			t.Errorf("expected buildings within 4 of the road, got %v", q)
+		}
+	}
+	if p.placed[0].X != 0 {
+		t.Errorf("expected the first building beside the road, got %v", p.placed[0])
+	}
+}
+
+func TestGridPlacementLots(t *testing.T) {
+	p := newTestPlacer(t, 12, 12, 0)
+	(&GridPlacement{Lot: image.Pt(3, 3), Gap: 1}).PlaceBuildings(p, rand.New(rand.NewSource(1)))
+	p.checkPlaced()
+
+	if len(p.placed) != 9 {
+		t.Errorf("expected a building in each of 9 lots, got %d", len(p.placed))
+	}
+	for _, q := range p.placed {
+		if q.X%4 != 0 || q.Y%4 != 0 {
+			t.Errorf("expected buildings at the top left of each lot, got %v", q)
+		}
+	}
+}
+
+func TestScatterPlacementSpacing(t *testing.T) {
+	p := newTestPlacer(t, 20, 20, 0)
+	(&ScatterPlacement{Spacing: 3, Attempts: 200}).PlaceBuildings(p, rand.New(rand.NewSource(1)))
+	p.checkPlaced()
+
+	if p.spacing != 3 {
+		t.Errorf("expected spacing set to 3, got %d", p.spacing)
+	}
+	for i, a := range p.placed {
+		for _, b := range p.placed[i+1:] {
+			if absint(a.X-b.X) < 2+3 && absint(a.Y-b.Y) < 2+3 {
+				t.Errorf("expected buildings at least 3 apart, got %v & %v", a, b)
+			}
+		}
+	}
+}
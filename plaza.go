@@ -0,0 +1,130 @@
+package citygraph
+
+import (
+	"image"
+)
+
+// Plaza is an open area carved out around a major junction
+type Plaza struct {
+	ID       int
+	Junction int // ID of the junction (see RoadNetwork.Junctions)
+	Area     image.Rectangle
+
+	// the feature placed in the middle of the plaza, if any
+	// (see PlazaSettings.Feature)
+	Feature *Building `json:",omitempty"`
+}
+
+// addPlazas carves open plazas at junctions where enough main roads meet,
+// or where arterial roads cross (see PlazaSettings).
+// Must be called after the RoadNetwork is linked & before buildings are
+// placed so that buildings keep clear of our plazas.
+func (c *Citygraph) addPlazas() {
+	ps := c.cfg.Plazas
+	size := ps.Area.Size()
+	if size.X <= 0 || size.Y <= 0 {
+		return
+	}
+
+	for _, j := range c.RoadNetwork.Junctions {
+		main, arterial := 0, 0
+		for _, id := range j.Roads {
+			switch c.RoadNetwork.Roads[id].Hierarchy {
+			case ArterialRoad:
+				arterial++
+				main++
+			case MainRoad:
+				main++
+			}
+		}
+		wanted := ps.MinRoads > 0 && main >= ps.MinRoads
+		wanted = wanted || (ps.ArterialCrossings && arterial >= 3)
+		if !wanted {
+			continue
+		}
+
+		area := image.Rect(0, 0, size.X, size.Y).Add(j.Point.Sub(size.Div(2))).Intersect(c.cfg.Area)
+		if area.Empty() || c.overlapsPlaza(area) {
+			continue
+		}
+
+		pl := &Plaza{ID: len(c.Plazas), Junction: j.ID, Area: area}
+		carved := 0
+		for y := area.Min.Y; y < area.Max.Y; y++ {
+			for x := area.Min.X; x < area.Max.X; x++ {
+				if !c.outline.CanBuildOn(x, y) || !c.cmap.isBlank(x, y) {
+					continue // water, roads, walls & the like are left as they are
+				}
+				c.cmap.setFeature(x, y, featurePlaza)
+				carved++
+			}
+		}
+		if carved == 0 {
+			continue
+		}
+
+		if ps.Feature != nil {
+			pl.Feature = c.addPlazaFeature(area, ps.Feature)
+		}
+		c.Plazas = append(c.Plazas, pl)
+	}
+}
+
+// overlapsPlaza returns if the area overlaps any plaza we've already placed
+func (c *Citygraph) overlapsPlaza(area image.Rectangle) bool {
+	for _, pl := range c.Plazas {
+		if pl.Area.Overlaps(area) {
+			return true
+		}
+	}
+	return false
+}
+
+// addPlazaFeature places the given building as near as we can to the middle
+// of the plaza, only on pixels that are plaza (ie. not on roads).
+func (c *Citygraph) addPlazaFeature(area image.Rectangle, b *BuildingConfig) *Building {
+	mid := image.Pt((area.Min.X+area.Max.X)/2, (area.Min.Y+area.Max.Y)/2)
+	bsize := b.Area.Size()
+
+	var best *image.Point
+	fromCentre := 0
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			dist := int(calculateDist(x+bsize.X/2, y+bsize.Y/2, mid.X, mid.Y))
+			if best != nil && dist >= fromCentre {
+				continue
+			}
+			if c.plazaFits(x, y, b) {
+				best = &image.Point{X: x, Y: y}
+				fromCentre = dist
+			}
+		}
+	}
+	if best == nil {
+		return nil
+	}
+
+	c.cmap.setBuilding(best.X, best.Y, b)
+	for dy := b.Area.Min.Y; dy < b.Area.Max.Y; dy++ {
+		for dx := b.Area.Min.X; dx < b.Area.Max.X; dx++ {
+			if b.covers(dx, dy) {
+				c.cmap.clearFeature(best.X+dx, best.Y+dy, featurePlaza)
+			}
+		}
+	}
+
+	return &Building{ID: b.ID, Area: b.Area.Add(*best), Footprint: b.Footprint, Tags: copyTags(b.Tags)}
+}
+
+// plazaFits returns if the building b fits at (ox,oy) (top left) entirely
+// on plaza pixels
+func (c *Citygraph) plazaFits(ox, oy int, b *BuildingConfig) bool {
+	for y := b.Area.Min.Y; y < b.Area.Max.Y; y++ {
+		for x := b.Area.Min.X; x < b.Area.Max.X; x++ {
+			if b.covers(x, y) && !c.cmap.IsPlaza(x+ox, y+oy) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,250 @@
+package citygraph
+
+import (
+	"image"
+	"math"
+)
+
+// defaultPosternWidth see FortificationSettings.PosternWidth
+const defaultPosternWidth = 2
+
+// Postern is a narrow opening through a wall without a gatehouse (a sally
+// port), cut where a minor road runs up to the wall (see Citygraph.Posterns)
+type Postern struct {
+	// the line through the middle of the opening, from the inside face of
+	// the wall to the outside face
+	Path  [2]image.Point
+	Width int
+
+	// the districts within & outside of the wall
+	Inside  int
+	Outside int
+
+	// the direction the postern faces (out of the wall) in degrees clockwise
+	// from north (up the map)
+	Facing float64
+
+	// ID of the (minor) road that runs up to the postern
+	Road int
+}
+
+// addPosterns cuts posterns through walls where minor roads run up to them,
+// up to MaxPosterns per wall spread around it (see
+// FortificationSettings.MaxPosterns)
+func (c *Citygraph) addPosterns() {
+	f := c.cfg.Fortifications
+	spacing := f.PosternSpacing
+	if spacing <= 0 {
+		spacing = f.MinDistBetweenTowers
+	}
+	width := f.PosternWidth
+	if width <= 0 {
+		width = defaultPosternWidth
+	}
+
+	rings := append([]*WallRing{}, c.WallRings...)
+	for _, d := range c.Districts {
+		rings = append(rings, d.WallRings...)
+	}
+
+	// nb. gates & other posterns must be at least spacing away
+	tooClose := func(p image.Point) bool {
+		for _, g := range c.gateLocs {
+			gc := image.Pt((g.Gatehouse.Min.X+g.Gatehouse.Max.X)/2, (g.Gatehouse.Min.Y+g.Gatehouse.Max.Y)/2)
+			if calculateDist(gc.X, gc.Y, p.X, p.Y) < float64(spacing) {
+				return true
+			}
+		}
+		for _, pt := range c.Posterns {
+			mid := pt.mid()
+			if calculateDist(mid.X, mid.Y, p.X, p.Y) < float64(spacing) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, r := range rings {
+		// every place a minor road runs up to the wall, by how far around
+		// the ring it is (see nearestRing)
+		type candidate struct {
+			pt    *Postern
+			pnts  []image.Point
+			along float64
+		}
+		cands := []*candidate{}
+		for _, road := range c.RoadNetwork.Roads {
+			if road.Hierarchy != MinorRoad {
+				continue
+			}
+			for _, s := range road.Sections {
+				for _, l := range s.lines() {
+					for _, end := range [][2]image.Point{{l[0], l[1]}, {l[1], l[0]}} {
+						pt, pnts := c.postern(r, end[1], end[0], road.Width, width)
+						if pt == nil {
+							continue
+						}
+						pt.Road = road.ID
+						_, along := nearestRing([]*WallRing{r}, pt.mid())
+						cands = append(cands, &candidate{pt: pt, pnts: pnts, along: along})
+					}
+				}
+			}
+		}
+
+		// spread the posterns evenly around the ring, taking the candidate
+		// nearest each of MaxPosterns evenly spaced points along it
+		n := float64(len(r.Vertices))
+		used := map[*candidate]bool{}
+		for i := 0; i < f.MaxPosterns && len(used) < len(cands); i++ {
+			target := (float64(i) + 0.5) * n / float64(f.MaxPosterns)
+
+			var best *candidate
+			bestDist := math.Inf(1)
+			for _, cd := range cands {
+				if used[cd] {
+					continue
+				}
+				d := math.Abs(cd.along - target)
+				d = math.Min(d, n-d) // the ring is a loop
+				if d < bestDist && !tooClose(cd.pt.mid()) {
+					best, bestDist = cd, d
+				}
+			}
+			if best == nil {
+				break
+			}
+			used[best] = true
+			c.cmap.cutPostern(best.pnts)
+			c.Posterns = append(c.Posterns, best.pt)
+		}
+	}
+}
+
+// postern returns a postern through the wall of ring r, where a road (of
+// the given width) ends at p having come from `from`, & the pixels of wall
+// that must be cleared for it. We return nil if the road doesn't run up to
+// the wall, or the postern would run into a tower or gatehouse.
+func (c *Citygraph) postern(r *WallRing, p, from image.Point, roadWidth, width int) (*Postern, []image.Point) {
+	open := map[int]bool{}
+	for _, i := range r.Open {
+		open[i] = true
+	}
+
+	// the stretch of wall nearest the end of the road
+	best, bestDist := -1, math.Inf(1)
+	for i := range r.Vertices {
+		if open[i] {
+			continue
+		}
+		a, b := r.Vertices[i], r.Vertices[(i+1)%len(r.Vertices)]
+		if d := distToSegment(p, a, b); d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	if best < 0 || bestDist > float64(c.maxWallWidth()/2+roadWidth+2) {
+		return nil, nil
+	}
+	a, b := r.Vertices[best], r.Vertices[(best+1)%len(r.Vertices)]
+	ux, uy, length := unitVector(a, b)
+	t := projection(a, b, p)
+	if length == 0 || t <= 0 || t >= 1 {
+		return nil, nil
+	}
+	nx, ny := -uy, ux
+
+	// the road should be heading into the wall, not running along it
+	rx, ry, rl := unitVector(from, p)
+	if rl == 0 || math.Abs(rx*nx+ry*ny) < 0.5 {
+		return nil, nil
+	}
+
+	foot := image.Pt(a.X+int(math.Round(t*float64(b.X-a.X))), a.Y+int(math.Round(t*float64(b.Y-a.Y))))
+	at := func(along, across int) image.Point {
+		return image.Pt(
+			foot.X+int(math.Round(ux*float64(along)+nx*float64(across))),
+			foot.Y+int(math.Round(uy*float64(along)+ny*float64(across))),
+		)
+	}
+
+	// how far the wall extends either side of it's line
+	limit := c.maxWallWidth() + c.largestTowerSize()
+	thickness := [2]int{}
+	for i, dir := range []int{1, -1} {
+		s := 0
+		for ; s <= limit; s++ {
+			q := at(0, dir*s)
+			if !c.cmap.isFortification(q.X, q.Y) {
+				break
+			}
+		}
+		if s == 0 || s > limit {
+			return nil, nil
+		}
+		thickness[i] = s
+	}
+
+	// the opening must pass clean through the wall, missing any towers
+	pnts := []image.Point{}
+	for along := -(width - 1) / 2; along <= width/2; along++ {
+		for across := -thickness[1] - 1; across <= thickness[0]+1; across++ {
+			q := at(along, across)
+			if c.cmap.isDrawnTower(q.X, q.Y) {
+				return nil, nil
+			}
+			if !c.cmap.isFortification(q.X, q.Y) {
+				continue
+			}
+			if across == -thickness[1]-1 || across == thickness[0]+1 {
+				return nil, nil // the wall is thicker here (ie. a corner)
+			}
+			pnts = append(pnts, q)
+		}
+	}
+
+	// & come out somewhere we can walk on either side
+	faces := [2]image.Point{at(0, thickness[0]), at(0, -thickness[1])}
+	for _, q := range faces {
+		if !q.In(c.cfg.Area) || !c.outline.CanBuildOn(q.X, q.Y) || c.cmap.isProtected(q.X, q.Y) {
+			return nil, nil
+		}
+	}
+
+	districts := map[int]bool{}
+	for _, id := range r.Districts {
+		districts[id] = true
+	}
+	sides := [2]int{c.graph.SiteFor(faces[0].X, faces[0].Y).ID(), c.graph.SiteFor(faces[1].X, faces[1].Y).ID()}
+	if districts[sides[1]] {
+		faces[0], faces[1] = faces[1], faces[0]
+		sides[0], sides[1] = sides[1], sides[0]
+	}
+
+	facing := math.Atan2(float64(faces[1].X-faces[0].X), float64(faces[0].Y-faces[1].Y)) * 180 / math.Pi
+	if facing < 0 {
+		facing += 360
+	}
+
+	return &Postern{
+		Path:    faces,
+		Width:   width,
+		Inside:  sides[0],
+		Outside: sides[1],
+		Facing:  facing,
+	}, pnts
+}
+
+// maxWallWidth returns the width of the thickest wall
+func (c *Citygraph) maxWallWidth() int {
+	f := c.cfg.Fortifications
+	width := maxint(f.WallWidth, f.CurtainWallWidth)
+	for _, r := range f.Rings {
+		width = maxint(width, r.WallWidth)
+	}
+	return width
+}
+
+// mid returns the middle of the opening
+func (p *Postern) mid() image.Point {
+	return image.Pt((p.Path[0].X+p.Path[1].X)/2, (p.Path[0].Y+p.Path[1].Y)/2)
+}
@@ -0,0 +1,169 @@
+package citygraph
+
+import (
+	"image"
+)
+
+// wallSpec holds the settings we build a single ring of wall with
+type wallSpec struct {
+	width    int
+	towerGap int // see MinDistBetweenTowers
+	maxGates int
+	moat     int // see MoatWidth
+	ring     int // see gateLocation.ring
+
+	// places that roads will come from (ie. external connections), we prefer
+	// gates near them
+	toward [][2]image.Point
+
+	// gate locations that open on to pockets (see pocketGates)
+	pockets map[*gateLocation]int
+}
+
+// cityWallSpec returns the settings for the main city wall
+func (c *Citygraph) cityWallSpec() wallSpec {
+	f := c.cfg.Fortifications
+	return wallSpec{width: f.WallWidth, towerGap: f.MinDistBetweenTowers, maxGates: f.MaxCityGates, moat: f.MoatWidth}
+}
+
+// curtainWallSpec returns the settings for walls around a single district
+func (c *Citygraph) curtainWallSpec() wallSpec {
+	f := c.cfg.Fortifications
+	return wallSpec{width: f.CurtainWallWidth, towerGap: f.MinDistBetweenTowers, maxGates: 1}
+}
+
+// ringSpec returns the settings for an inner ring, where anything not set
+// falls back to the main city wall. Only the main city wall has a moat.
+func (c *Citygraph) ringSpec(r *RingSettings) wallSpec {
+	spec := c.cityWallSpec()
+	spec.moat = 0
+	if r.WallWidth > 0 {
+		spec.width = r.WallWidth
+	}
+	if r.MinDistBetweenTowers > 0 {
+		spec.towerGap = r.MinDistBetweenTowers
+	}
+	if r.MaxCityGates > 0 {
+		spec.maxGates = r.MaxCityGates
+	}
+	return spec
+}
+
+// gatehouseSize returns the width & height of a gatehouse including it's
+// flanking towers; edges shorter than this cannot hold a gate.
+func (c *Citygraph) gatehouseSize() (int, int) {
+	f := c.cfg.Fortifications
+	tower := c.gateTowerArea()
+	width := (tower.Max.X-tower.Min.X)*2 + f.GatehouseArea.Max.X - f.GatehouseArea.Min.X
+	height := (tower.Max.Y-tower.Min.Y)*2 + f.GatehouseArea.Max.Y - f.GatehouseArea.Min.Y
+	return width, height
+}
+
+// addRings builds each of the inner rings of wall (see FortificationSettings.Rings)
+// where `parent` holds the districts within the main city wall & `gates` the
+// gates made in it. Each ring is built within the last & has it's gates placed
+// to line up with the roads running inward from the gates of the ring outside it.
+// We return allTowers with all towers we added.
+func (c *Citygraph) addRings(parent []*District, gates []*gateLocation, allTowers []image.Rectangle) []image.Rectangle {
+	for i, r := range c.cfg.Fortifications.Rings {
+		inside := c.ringDistricts(parent, r)
+		if len(inside) == 0 || len(inside) >= len(parent) {
+			break // nothing to wall, or we'd simply follow the last wall
+		}
+
+		isInside := map[int]bool{}
+		for _, d := range inside {
+			isInside[d.ID] = true
+		}
+		outside := []*District{}
+		for _, d := range parent {
+			if !isInside[d.ID] {
+				outside = append(outside, d)
+			}
+		}
+
+		// roads from the outer gates head toward the centre, so we'd like our
+		// gates along those lines
+		lines := [][2]image.Point{}
+		for _, g := range gates {
+			gc := image.Pt((g.Gatehouse.Min.X+g.Gatehouse.Max.X)/2, (g.Gatehouse.Min.Y+g.Gatehouse.Max.Y)/2)
+			lines = append(lines, [2]image.Point{gc, c.cfg.Centre})
+		}
+		candidates := c.ringGates(inside, isInside)
+		spec := c.ringSpec(r)
+		spec.ring = i + 1
+		spec.toward = lines
+		spec.pockets = c.pocketGates(candidates, outside, gates)
+
+		ws, gs, ts, bs, rs := c.wallDistricts(inside, outside, candidates, allTowers, spec)
+		c.Walls = append(c.Walls, ws...)
+		c.Towers = append(c.Towers, ts...)
+		c.Bastions = append(c.Bastions, bs...)
+		c.WallRings = append(c.WallRings, rs...)
+		allTowers = append(allTowers, ts...)
+
+		gates = []*gateLocation{}
+		for _, g := range gs {
+			g.ring = i + 1
+			c.Gates = append(c.Gates, g.Gatehouse)
+			c.GateScores = append(c.GateScores, g.scored())
+			c.Ravelins = append(c.Ravelins, g.ravelin...)
+			c.gateLocs = append(c.gateLocs, g)
+			gates = append(gates, g)
+		}
+
+		parent = inside
+	}
+
+	return allTowers
+}
+
+// ringDistricts returns the districts of `parent` that fall within the ring
+func (c *Citygraph) ringDistricts(parent []*District, r *RingSettings) []*District {
+	sorted := make([]*District, len(parent))
+	copy(sorted, parent)
+	sortDistrictsByDistance(c.cfg.Centre, sorted)
+
+	if r.Radius > 0 {
+		inside := []*District{}
+		for _, d := range sorted {
+			if calculateDist(d.Site.X, d.Site.Y, c.cfg.Centre.X, c.cfg.Centre.Y) <= float64(r.Radius) {
+				inside = append(inside, d)
+			}
+		}
+		return inside
+	}
+
+	if r.MinFortifiedSites >= len(sorted) {
+		return sorted
+	}
+	if r.MinFortifiedSites <= 0 {
+		return []*District{}
+	}
+	return sorted[:r.MinFortifiedSites]
+}
+
+// ringGates returns all the places we could put a gate in a wall around the
+// `inside` districts, where gates lead to a district of the ring outside it.
+func (c *Citygraph) ringGates(inside []*District, isInside map[int]bool) []*gateLocation {
+	ghWidth, ghHeight := c.gatehouseSize()
+
+	gates := []*gateLocation{}
+	for _, d := range inside {
+		site := c.graph.SiteByID(d.ID)
+		for _, n := range site.Neighbours() {
+			dist, ok := c.cellToDist[n.Site.ID()]
+			if !ok || isInside[dist.ID] || dist.HasCurtainFortifications || !dist.HasFortifications {
+				continue
+			}
+			for _, e := range n.Edges {
+				length := int(calculateDist(e[0].X, e[0].Y, e[1].X, e[1].Y))
+				if length < ghWidth || length < ghHeight {
+					continue
+				}
+				gates = append(gates, &gateLocation{In: site, InDist: d, Out: n.Site, OutDist: dist, Edge: e})
+			}
+		}
+	}
+	return gates
+}
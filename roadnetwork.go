@@ -0,0 +1,366 @@
+package citygraph
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+// RoadHierarchy indicates roughly how important a road is to the city
+type RoadHierarchy string
+
+const (
+	ArterialRoad  RoadHierarchy = "arterial"  // major roads running from gates to the city centre
+	MainRoad      RoadHierarchy = "main"      // roads between districts (along voronoi edges)
+	MinorRoad     RoadHierarchy = "minor"     // roads within a district
+	WallSideRoad  RoadHierarchy = "wall-side" // roads that run alongside walls / towers
+	ConnectorRoad RoadHierarchy = "connector" // roads added to connect otherwise unreachable roads
+	AlleyRoad     RoadHierarchy = "alley"     // narrow paths cutting through large blocks
+)
+
+// RoadNetwork is the city wide graph of roads (edges) & the junctions (nodes)
+// where they meet. Unlike District.Roads each road here is listed exactly once,
+// along with all of the districts that it borders or runs through.
+type RoadNetwork struct {
+	Junctions []*Junction
+	Roads     []*Road
+	Streets   []*Street `json:",omitempty"` // see CityConfig.StreetNamer
+
+	// roads by edgeID so we can find roads shared by districts
+	byEdge map[string]*Road
+
+	// road ID + 1 for every pixel in bounds (0 indicates "no road")
+	bounds image.Rectangle
+	index  []int
+}
+
+// Junction is a point where road(s) meet, or where a road ends
+type Junction struct {
+	ID    int
+	Point image.Point
+	Roads []int // IDs of roads that meet here
+}
+
+// Road is an Edge in the road network with some extra information about
+// what sort of road it is & where it goes.
+type Road struct {
+	ID int
+	*Edge
+
+	Width     int // width in pixels (as drawn)
+	Hierarchy RoadHierarchy
+	Bridges   int   `json:",omitempty"` // number of Sections that are bridges
+	Districts []int // IDs of districts that this road borders / runs through
+
+	// IDs of junctions along this road, ordered from Path[0] to Path[1]
+	Junctions []int
+
+	// how far (in pixels) from the Path this road could have been drawn
+	reach int
+}
+
+// newRoadNetwork returns a blank network for the given area
+func newRoadNetwork(bounds image.Rectangle) *RoadNetwork {
+	return &RoadNetwork{
+		Junctions: []*Junction{},
+		Roads:     []*Road{},
+		byEdge:    map[string]*Road{},
+		bounds:    bounds,
+	}
+}
+
+// find returns the road running along (a,b) if we have one
+func (n *RoadNetwork) find(a, b image.Point) *Road {
+	r, _ := n.byEdge[edgeID(a, b)]
+	return r
+}
+
+// add records a road (that has been drawn) in the network
+func (n *RoadNetwork) add(e *Edge, width int, h RoadHierarchy, districts ...int) *Road {
+	if width < 1 {
+		width = 1
+	}
+
+	r := &Road{
+		ID:        len(n.Roads),
+		Edge:      e,
+		Width:     width,
+		Hierarchy: h,
+		Districts: []int{},
+		Junctions: []int{},
+		reach:     width/2 + 1,
+	}
+	for _, s := range e.Sections {
+		if s.Bridge {
+			r.Bridges++
+		}
+	}
+	for _, d := range districts {
+		r.addDistrict(d)
+	}
+
+	n.Roads = append(n.Roads, r)
+	n.byEdge[edgeID(e.Path[0], e.Path[1])] = r
+
+	return r
+}
+
+// addDistrict marks that the road borders / runs through the given district
+func (r *Road) addDistrict(id int) {
+	for _, d := range r.Districts {
+		if d == id {
+			return
+		}
+	}
+	r.Districts = append(r.Districts, id)
+}
+
+// ends returns the first & last points of the road that were actually drawn,
+// which isn't necessarily the same as the Path.
+func (r *Road) ends() (image.Point, image.Point, bool) {
+	if len(r.Sections) == 0 {
+		return image.ZP, image.ZP, false
+	}
+
+	lo, hi := math.Inf(1), math.Inf(-1)
+	var first, last image.Point
+	for _, s := range r.Sections {
+		for _, p := range s.Path {
+			t := projection(r.Path[0], r.Path[1], p)
+			if t < lo {
+				lo, first = t, p
+			}
+			if t > hi {
+				hi, last = t, p
+			}
+		}
+	}
+
+	return first, last, true
+}
+
+// distTo returns the shortest distance from p to any drawn section of the road
+func (r *Road) distTo(p image.Point) float64 {
+	best := math.Inf(1)
+	for _, s := range r.Sections {
+		for _, l := range s.lines() {
+			best = math.Min(best, distToSegment(p, l[0], l[1]))
+		}
+	}
+	return best
+}
+
+// RoadAt returns the road that the pixel at x,y belongs to, or nil
+// if there is no road there.
+func (n *RoadNetwork) RoadAt(x, y int) *Road {
+	p := image.Pt(x, y)
+	if n.index == nil || !p.In(n.bounds) {
+		return nil
+	}
+	id := n.index[n.pixel(x, y)]
+	if id == 0 {
+		return nil
+	}
+	return n.Roads[id-1]
+}
+
+// Junction returns the junction with the given ID, or nil
+func (n *RoadNetwork) Junction(id int) *Junction {
+	if id < 0 || id >= len(n.Junctions) {
+		return nil
+	}
+	return n.Junctions[id]
+}
+
+// pixel returns the index of x,y in our index
+func (n *RoadNetwork) pixel(x, y int) int {
+	return (y-n.bounds.Min.Y)*n.bounds.Dx() + (x - n.bounds.Min.X)
+}
+
+// link figures out the junctions of the network; where roads end & where they
+// meet. Road ends within `tolerance` pixels of each other are considered the
+// same junction. Road ends that finish part way along another road are also
+// counted as a junction on that road (ie. a "T" junction).
+func (n *RoadNetwork) link(tolerance int) {
+	if tolerance < 1 {
+		tolerance = 1
+	}
+
+	n.Junctions = []*Junction{}
+	for _, r := range n.Roads {
+		r.Junctions = []int{}
+	}
+
+	// bucket junctions so we aren't comparing every junction to every road end
+	cell := tolerance * 4
+	grid := map[image.Point][]*Junction{}
+	bucket := func(p image.Point) image.Point {
+		return image.Pt(p.X/cell, p.Y/cell)
+	}
+
+	attach := func(j *Junction, r *Road) {
+		for _, id := range j.Roads {
+			if id == r.ID {
+				return
+			}
+		}
+		j.Roads = append(j.Roads, r.ID)
+		r.Junctions = append(r.Junctions, j.ID)
+	}
+
+	junctionAt := func(p image.Point) *Junction {
+		b := bucket(p)
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				for _, j := range grid[b.Add(image.Pt(dx, dy))] {
+					if calculateDist(j.Point.X, j.Point.Y, p.X, p.Y) <= float64(tolerance) {
+						return j
+					}
+				}
+			}
+		}
+		j := &Junction{ID: len(n.Junctions), Point: p, Roads: []int{}}
+		n.Junctions = append(n.Junctions, j)
+		grid[b] = append(grid[b], j)
+		return j
+	}
+
+	for _, r := range n.Roads {
+		a, b, ok := r.ends()
+		if !ok {
+			continue
+		}
+		attach(junctionAt(a), r)
+		attach(junctionAt(b), r)
+	}
+
+	// now look for junctions that sit somewhere along a road
+	for _, r := range n.Roads {
+		if len(r.Sections) == 0 {
+			continue
+		}
+		bnds := segmentBounds(r.Path[0], r.Path[1], r.Width+tolerance)
+		for _, s := range r.Sections {
+			for _, l := range s.lines() {
+				bnds = bnds.Union(segmentBounds(l[0], l[1], r.Width+tolerance))
+			}
+		}
+		lo, hi := bucket(bnds.Min), bucket(bnds.Max)
+		for by := lo.Y; by <= hi.Y; by++ {
+			for bx := lo.X; bx <= hi.X; bx++ {
+				for _, j := range grid[image.Pt(bx, by)] {
+					if r.distTo(j.Point) <= float64(r.Width+tolerance) {
+						attach(j, r)
+					}
+				}
+			}
+		}
+	}
+
+	for _, r := range n.Roads {
+		a, b := r.Path[0], r.Path[1]
+		sort.Slice(r.Junctions, func(i, k int) bool {
+			return projection(a, b, n.Junctions[r.Junctions[i]].Point) < projection(a, b, n.Junctions[r.Junctions[k]].Point)
+		})
+	}
+}
+
+// buildIndex works out which road every road pixel in the map belongs to.
+// Roads are drawn as thick lines & overlap at junctions, so pixels are given
+// to the nearest road that could have drawn them. Any pixels we can't match
+// this way (ie. painted around walls) are given to the closest road that they
+// connect to.
+func (n *RoadNetwork) buildIndex(cm CityMap) {
+	n.index = make([]int, n.bounds.Dx()*n.bounds.Dy())
+	best := make([]float64, len(n.index))
+
+	isRoad := func(x, y int) bool {
+		return cm.IsRoad(x, y) || cm.IsBridge(x, y) || cm.IsFord(x, y) || cm.IsFerry(x, y) || cm.IsAlley(x, y)
+	}
+
+	queue := []image.Point{}
+	for _, r := range n.Roads {
+		for _, s := range r.Sections {
+			for _, l := range s.lines() {
+				area := segmentBounds(l[0], l[1], r.reach).Intersect(n.bounds)
+				for y := area.Min.Y; y < area.Max.Y; y++ {
+					for x := area.Min.X; x < area.Max.X; x++ {
+						if !isRoad(x, y) {
+							continue
+						}
+						d := distToSegment(image.Pt(x, y), l[0], l[1])
+						if d > float64(r.reach) {
+							continue
+						}
+						i := n.pixel(x, y)
+						if n.index[i] == 0 {
+							queue = append(queue, image.Pt(x, y))
+						} else if d >= best[i] {
+							continue
+						}
+						n.index[i] = r.ID + 1
+						best[i] = d
+					}
+				}
+			}
+		}
+	}
+
+	// flood out from what we know to any connected road pixels
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		id := n.index[n.pixel(p.X, p.Y)]
+		for _, d := range []image.Point{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+			q := p.Add(d)
+			if !q.In(n.bounds) || !isRoad(q.X, q.Y) {
+				continue
+			}
+			i := n.pixel(q.X, q.Y)
+			if n.index[i] != 0 {
+				continue
+			}
+			n.index[i] = id
+			queue = append(queue, q)
+		}
+	}
+
+	// anything that is left is an island; give each (as a whole) to the road
+	// nearest it's middle
+	if len(n.Roads) == 0 {
+		return
+	}
+	for y := n.bounds.Min.Y; y < n.bounds.Max.Y; y++ {
+		for x := n.bounds.Min.X; x < n.bounds.Max.X; x++ {
+			if !isRoad(x, y) || n.index[n.pixel(x, y)] != 0 {
+				continue
+			}
+
+			n.index[n.pixel(x, y)] = -1 // seen
+			island := []image.Point{image.Pt(x, y)}
+			sum := image.Pt(x, y)
+			for k := 0; k < len(island); k++ {
+				for _, d := range []image.Point{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+					q := island[k].Add(d)
+					if !q.In(n.bounds) || !isRoad(q.X, q.Y) || n.index[n.pixel(q.X, q.Y)] != 0 {
+						continue
+					}
+					n.index[n.pixel(q.X, q.Y)] = -1
+					island = append(island, q)
+					sum = sum.Add(q)
+				}
+			}
+
+			mid := sum.Div(len(island))
+			id, nearest := 0, math.Inf(1)
+			for _, r := range n.Roads {
+				if d := r.distTo(mid); d < nearest {
+					id, nearest = r.ID+1, d
+				}
+			}
+			for _, q := range island {
+				n.index[n.pixel(q.X, q.Y)] = id
+			}
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package citygraph
+
+import (
+	"container/heap"
+	"fmt"
+	"image"
+	"math"
+)
+
+var (
+	// ErrNoRoute implies there is no way to get between the given points
+	// using the road network (with the given options).
+	ErrNoRoute = fmt.Errorf("no route found")
+)
+
+// RouteOptions configures how Route picks a path through the city.
+// Each pixel of road costs 1 to travel over, the options here add to (or
+// multiply) that cost for various kinds of pixels.
+type RouteOptions struct {
+	// Cost of a single bridge pixel (values less than 1 are treated as 1)
+	BridgeCost float64
+
+	// Cost of a single gatehouse pixel (values less than 1 are treated as 1)
+	GatehouseCost float64
+
+	// Cost of a single ford / ferry pixel (values less than 1 are treated as 1)
+	FordCost  float64
+	FerryCost float64
+
+	// Extra cost added to each pixel of road, divided by the width of the road.
+	// Ie. higher values prefer wider (main) roads over narrow side streets.
+	WidthCost float64
+
+	// ForbidGates disallows routing through gatehouses (including those of
+	// district curtain walls).
+	ForbidGates bool
+
+	// ForbidPosterns disallows routing through posterns (see
+	// FortificationSettings.MaxPosterns).
+	ForbidPosterns bool
+
+	// SnapDistance is how far (in pixels) from the start / end we'll search
+	// for a road if they aren't on one.
+	// 0 or less defaults to 10.
+	SnapDistance int
+}
+
+// Route is a path through the city along roads, bridges, fords, ferries,
+// plazas, alleys, gates & posterns.
+type Route struct {
+	// every pixel along the route, in order, from start to end
+	Points []image.Point
+
+	// roads travelled along, in the order that they are travelled
+	Roads []*Road
+
+	// total cost of the route (see RouteOptions)
+	Cost float64
+}
+
+// Route finds the cheapest path between two points in the city, where
+// we're only permitted to travel on roads, bridges, fords, ferries & through
+// gatehouses & posterns.
+// If either point isn't on a road we start (or end) at the nearest road pixel.
+// Since this works directly from the CityMap, it can be used on any generated
+// city without extra work.
+func (c *Citygraph) Route(from, to image.Point, opts *RouteOptions) (*Route, error) {
+	if opts == nil {
+		opts = &RouteOptions{}
+	}
+	snap := opts.SnapDistance
+	if snap <= 0 {
+		snap = 10
+	}
+
+	r := &router{cm: c.cmap, roads: c.RoadNetwork, bounds: c.cfg.Area, opts: opts}
+
+	start, ok := r.nearestWalkable(from, snap)
+	if !ok {
+		return nil, fmt.Errorf("%w: no road within %d of %v", ErrNoRoute, snap, from)
+	}
+	end, ok := r.nearestWalkable(to, snap)
+	if !ok {
+		return nil, fmt.Errorf("%w: no road within %d of %v", ErrNoRoute, snap, to)
+	}
+
+	return r.search(start, end)
+}
+
+// router holds what we need to perform a route search
+type router struct {
+	cm     CityMap
+	roads  *RoadNetwork
+	bounds image.Rectangle
+	opts   *RouteOptions
+}
+
+// walkable returns if we're permitted to travel over x,y
+func (r *router) walkable(x, y int) bool {
+	if !image.Pt(x, y).In(r.bounds) {
+		return false
+	}
+	if r.cm.IsGatehouse(x, y) {
+		return !r.opts.ForbidGates
+	}
+	if r.cm.IsPostern(x, y) {
+		return !r.opts.ForbidPosterns
+	}
+	return r.cm.IsRoad(x, y) || r.cm.IsBridge(x, y) || r.cm.IsFord(x, y) || r.cm.IsFerry(x, y) || r.cm.IsPlaza(x, y) || r.cm.IsAlley(x, y)
+}
+
+// cost returns the cost of stepping on to x,y
+func (r *router) cost(x, y int) float64 {
+	if r.cm.IsGatehouse(x, y) {
+		return math.Max(1, r.opts.GatehouseCost)
+	}
+
+	cost := 1.0
+	if r.cm.IsBridge(x, y) {
+		cost = math.Max(1, r.opts.BridgeCost)
+	} else if r.cm.IsFord(x, y) {
+		cost = math.Max(1, r.opts.FordCost)
+	} else if r.cm.IsFerry(x, y) {
+		cost = math.Max(1, r.opts.FerryCost)
+	}
+
+	if r.opts.WidthCost > 0 {
+		width := 1
+		if road := r.roads.RoadAt(x, y); road != nil {
+			width = road.Width
+		}
+		cost += r.opts.WidthCost / float64(width)
+	}
+
+	return cost
+}
+
+// nearestWalkable returns the closest walkable pixel to p (searching outward
+// in rings up to `radius` pixels away)
+func (r *router) nearestWalkable(p image.Point, radius int) (image.Point, bool) {
+	if r.walkable(p.X, p.Y) {
+		return p, true
+	}
+
+	best := -1.0
+	var pick image.Point
+	for ring := 1; ring <= radius; ring++ {
+		for dy := -ring; dy <= ring; dy++ {
+			for dx := -ring; dx <= ring; dx++ {
+				if maxint(absint(dx), absint(dy)) != ring || !r.walkable(p.X+dx, p.Y+dy) {
+					continue
+				}
+				d := calculateDist(p.X, p.Y, p.X+dx, p.Y+dy)
+				if best < 0 || d < best {
+					best = d
+					pick = image.Pt(p.X+dx, p.Y+dy)
+				}
+			}
+		}
+		if best >= 0 {
+			return pick, true
+		}
+	}
+
+	return p, false
+}
+
+// search is a standard A* search from start to end over walkable pixels
+func (r *router) search(start, end image.Point) (*Route, error) {
+	w := r.bounds.Dx()
+	index := func(p image.Point) int {
+		return (p.Y-r.bounds.Min.Y)*w + (p.X - r.bounds.Min.X)
+	}
+	point := func(i int) image.Point {
+		return image.Pt(i%w+r.bounds.Min.X, i/w+r.bounds.Min.Y)
+	}
+	estimate := func(p image.Point) float64 { // each step costs at least 1
+		return float64(absint(p.X-end.X) + absint(p.Y-end.Y))
+	}
+
+	size := w * r.bounds.Dy()
+	costs := make([]float64, size)
+	parent := make([]int, size)
+	for i := range costs {
+		costs[i] = math.Inf(1)
+		parent[i] = -1
+	}
+
+	open := &routeQueue{}
+	costs[index(start)] = 0
+	heap.Push(open, &routeNode{i: index(start), f: estimate(start)})
+
+	goal := index(end)
+	for open.Len() > 0 {
+		n := heap.Pop(open).(*routeNode)
+		if n.i == goal {
+			break
+		}
+
+		p := point(n.i)
+		if n.f-estimate(p) > costs[n.i] {
+			continue // we've already found a cheaper way here
+		}
+
+		for _, d := range []image.Point{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+			q := p.Add(d)
+			if !r.walkable(q.X, q.Y) {
+				continue
+			}
+			qi := index(q)
+			g := costs[n.i] + r.cost(q.X, q.Y)
+			if g >= costs[qi] {
+				continue
+			}
+			costs[qi] = g
+			parent[qi] = n.i
+			heap.Push(open, &routeNode{i: qi, f: g + estimate(q)})
+		}
+	}
+
+	if math.IsInf(costs[goal], 1) {
+		return nil, fmt.Errorf("%w: between %v and %v", ErrNoRoute, start, end)
+	}
+
+	route := &Route{Points: []image.Point{}, Roads: []*Road{}, Cost: costs[goal]}
+	for i := goal; i != -1; i = parent[i] {
+		route.Points = append(route.Points, point(i))
+	}
+	for a, b := 0, len(route.Points)-1; a < b; a, b = a+1, b-1 {
+		route.Points[a], route.Points[b] = route.Points[b], route.Points[a]
+	}
+
+	var prev *Road
+	for _, p := range route.Points {
+		road := r.roads.RoadAt(p.X, p.Y)
+		if road == nil || road == prev {
+			continue
+		}
+		route.Roads = append(route.Roads, road)
+		prev = road
+	}
+
+	return route, nil
+}
+
+// routeNode is a pixel (by index) in our A* search with it's estimated total cost
+type routeNode struct {
+	i int
+	f float64
+}
+
+// routeQueue is a min heap of routeNodes
+type routeQueue []*routeNode
+
+func (q routeQueue) Len() int            { return len(q) }
+func (q routeQueue) Less(a, b int) bool  { return q[a].f < q[b].f }
+func (q routeQueue) Swap(a, b int)       { q[a], q[b] = q[b], q[a] }
+func (q *routeQueue) Push(x interface{}) { *q = append(*q, x.(*routeNode)) }
+func (q *routeQueue) Pop() interface{} {
+	old := *q
+	n := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return n
+}
@@ -0,0 +1,133 @@
+package citygraph
+
+import (
+	"errors"
+	"image"
+	"testing"
+)
+
+// newRouteTestCity returns a small city with an L shaped road running from
+// (2,2) across to (15,2) & down to (15,15), plus a short road (2,15)-(5,15)
+// that isn't joined to it
+func newRouteTestCity() *Citygraph {
+	bounds := image.Rect(0, 0, 20, 20)
+	c := &Citygraph{
+		cfg:         &CityConfig{Area: bounds},
+		cmap:        newMap(bounds),
+		RoadNetwork: newRoadNetwork(bounds),
+	}
+	for x := 2; x <= 15; x++ {
+		c.cmap.setRoad(x, 2)
+	}
+	for y := 2; y <= 15; y++ {
+		c.cmap.setRoad(15, y)
+	}
+	for x := 2; x <= 5; x++ {
+		c.cmap.setRoad(x, 15)
+	}
+	return c
+}
+
+func TestRoute(t *testing.T) {
+	c := newRouteTestCity()
+
+	r, err := c.Route(image.Pt(2, 2), image.Pt(15, 15), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.Points) != 27 {
+		t.Errorf("expected 27 points, got %d", len(r.Points))
+	}
+	if r.Cost != 26 {
+		t.Errorf("expected cost 26, got %v", r.Cost)
+	}
+	if r.Points[0] != image.Pt(2, 2) || r.Points[len(r.Points)-1] != image.Pt(15, 15) {
+		t.Errorf("expected route from (2,2) to (15,15), got %v to %v", r.Points[0], r.Points[len(r.Points)-1])
+	}
+	for i := 1; i < len(r.Points); i++ {
+		d := r.Points[i].Sub(r.Points[i-1])
+		if absint(d.X)+absint(d.Y) != 1 {
+			t.Errorf("expected each point next to the last, got %v then %v", r.Points[i-1], r.Points[i])
+		}
+	}
+}
+
+func TestRouteSnapsToRoad(t *testing.T) {
+	c := newRouteTestCity()
+
+	r, err := c.Route(image.Pt(2, 5), image.Pt(18, 15), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Points[0] != image.Pt(2, 2) {
+		t.Errorf("expected start snapped to (2,2), got %v", r.Points[0])
+	}
+	if r.Points[len(r.Points)-1] != image.Pt(15, 15) {
+		t.Errorf("expected end snapped to (15,15), got %v", r.Points[len(r.Points)-1])
+	}
+
+	_, err = c.Route(image.Pt(2, 8), image.Pt(15, 15), &RouteOptions{SnapDistance: 2})
+	if !errors.Is(err, ErrNoRoute) {
+		t.Errorf("expected ErrNoRoute with no road in reach, got %v", err)
+	}
+}
+
+func TestRouteNoRoute(t *testing.T) {
+	c := newRouteTestCity()
+
+	_, err := c.Route(image.Pt(2, 2), image.Pt(5, 15), nil)
+	if !errors.Is(err, ErrNoRoute) {
+		t.Errorf("expected ErrNoRoute between unconnected roads, got %v", err)
+	}
+}
+
+func TestRouteCosts(t *testing.T) {
+	c := newRouteTestCity()
+	for x := 6; x <= 9; x++ {
+		c.cmap.setBridge(x, 2)
+	}
+
+	r, err := c.Route(image.Pt(2, 2), image.Pt(15, 2), &RouteOptions{BridgeCost: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Cost != 13+4*2 {
+		t.Errorf("expected cost %d with 4 bridge pixels, got %v", 13+4*2, r.Cost)
+	}
+}
+
+func TestRouteForbidGates(t *testing.T) {
+	c := newRouteTestCity()
+	bm := c.cmap.getBM(8, 2)
+	bm.Set(bitGate, true)
+	c.cmap.setBM(8, 2, bm)
+
+	if _, err := c.Route(image.Pt(2, 2), image.Pt(15, 15), nil); err != nil {
+		t.Errorf("expected route through the gatehouse, got %v", err)
+	}
+
+	_, err := c.Route(image.Pt(2, 2), image.Pt(15, 15), &RouteOptions{ForbidGates: true})
+	if !errors.Is(err, ErrNoRoute) {
+		t.Errorf("expected ErrNoRoute with gates forbidden, got %v", err)
+	}
+}
+
+func TestRoutePosterns(t *testing.T) {
+	c := newRouteTestCity()
+	c.cmap.setFeature(15, 16, featurePostern)
+	c.cmap.setRoad(15, 17)
+
+	r, err := c.Route(image.Pt(2, 2), image.Pt(15, 17), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Points[len(r.Points)-1] != image.Pt(15, 17) {
+		t.Errorf("expected route through the postern to (15,17), got %v", r.Points[len(r.Points)-1])
+	}
+
+	_, err = c.Route(image.Pt(2, 2), image.Pt(15, 17), &RouteOptions{ForbidPosterns: true})
+	if !errors.Is(err, ErrNoRoute) {
+		t.Errorf("expected ErrNoRoute with posterns forbidden, got %v", err)
+	}
+}
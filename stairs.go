@@ -0,0 +1,311 @@
+package citygraph
+
+import (
+	"image"
+	"math"
+
+	"github.com/voidshard/citygraph/internal/line"
+)
+
+// StairKind is the kind of a Stair (see FortificationSettings.Ramps)
+type StairKind string
+
+const (
+	StairFlight StairKind = "stairs"
+	StairRamp   StairKind = "ramp"
+)
+
+// Stair is a flight of stairs (or a ramp) up on to the wall walk, built
+// against the inside face of a wall (see Citygraph.Stairs)
+type Stair struct {
+	Kind StairKind
+
+	// the outline of the stair
+	Polygon []image.Point
+
+	// the bottom & top of the stair, which climbs along the wall
+	Foot image.Point
+	Top  image.Point
+
+	// the direction the stair climbs (from Foot to Top) in degrees clockwise
+	// from north (up the map)
+	Direction float64
+
+	// the nearest road pixel to the foot of the stair, which it's linked to
+	// by a short ConnectorRoad (see Link)
+	Road image.Point
+
+	// ID of the road from Foot to Road (see RoadNetwork.Roads)
+	Link int
+
+	// the gatehouse the stair is beside, if any
+	Gatehouse *image.Rectangle `json:",omitempty"`
+}
+
+// addStairs places stairs against the inside face of each wall, beside each
+// gatehouse & then every StairInterval pixels along the wall
+// (see FortificationSettings.StairInterval)
+func (c *Citygraph) addStairs() {
+	f := c.cfg.Fortifications
+	length := f.StairLength
+	if length <= 0 {
+		length = c.largestTowerSize() * 2
+	}
+	kind := StairFlight
+	if f.Ramps {
+		kind = StairRamp
+		length *= 2
+	}
+	depth := maxint(2, length/4)
+
+	rings := append([]*WallRing{}, c.WallRings...)
+	for _, d := range c.Districts {
+		rings = append(rings, d.WallRings...)
+	}
+
+	tooClose := func(p image.Point) bool {
+		for _, s := range c.Stairs {
+			mid := s.mid()
+			if calculateDist(mid.X, mid.Y, p.X, p.Y) < float64(f.StairInterval)/2 {
+				return true
+			}
+		}
+		return false
+	}
+
+	place := func(s *Stair) {
+		for _, p := range polygonPixels(s.Polygon) {
+			c.cmap.setFeature(p.X, p.Y, featureStairs)
+		}
+		s.Link = c.addStairRoad(s)
+		c.Stairs = append(c.Stairs, s)
+	}
+
+	for _, r := range rings {
+		open := map[int]bool{}
+		for _, i := range r.Open {
+			open[i] = true
+		}
+
+		// firstly, either side of each gatehouse
+		for _, g := range r.Gates {
+			i, along := nearestSegment(r, g.Front)
+			if i < 0 || open[i] {
+				continue
+			}
+			gatehouse := g.Gatehouse
+			clear := float64(maxint(gatehouse.Dx(), gatehouse.Dy()))/2 + float64(length)/2 + 1
+		gate:
+			for step := 0; step <= length*2; step += 2 {
+				for _, at := range []float64{along - clear - float64(step), along + clear + float64(step)} {
+					if s := c.stairAt(r, i, at, length, depth); s != nil {
+						s.Kind = kind
+						s.Gatehouse = &gatehouse
+						place(s)
+						break gate
+					}
+				}
+			}
+		}
+
+		// and then along the wall
+		walked, next := 0.0, float64(f.StairInterval)/2
+		for i := range r.Vertices {
+			a, b := r.Vertices[i], r.Vertices[(i+1)%len(r.Vertices)]
+			l := calculateDist(a.X, a.Y, b.X, b.Y)
+			for ; next < walked+l; next += float64(f.StairInterval) {
+				if open[i] {
+					continue
+				}
+				// nb. if the stair doesn't fit we shuffle along the wall a bit
+				for step := 0; step <= f.StairInterval/4; step += 2 {
+					placed := false
+					for _, at := range []float64{next - walked + float64(step), next - walked - float64(step)} {
+						s := c.stairAt(r, i, at, length, depth)
+						if s == nil || tooClose(s.mid()) {
+							continue
+						}
+						s.Kind = kind
+						place(s)
+						placed = true
+						break
+					}
+					if placed {
+						break
+					}
+				}
+			}
+			walked += l
+		}
+	}
+
+	// the stairs added roads, so work out how they connect again
+	if len(c.Stairs) > 0 {
+		c.RoadNetwork.link(c.cfg.MainRoadWidth)
+		c.RoadNetwork.buildIndex(c.cmap)
+	}
+}
+
+// addStairRoad draws a path (a ConnectorRoad) from the foot of the stair to
+// the road it's linked to & adds it to the RoadNetwork, returning it's ID.
+// Must be called once the stair itself is marked.
+func (c *Citygraph) addStairRoad(s *Stair) int {
+	for _, p := range line.PointsBetween(s.Foot, s.Road) {
+		if c.cmap.isBlank(p.X, p.Y) {
+			c.cmap.setRoad(p.X, p.Y)
+		}
+	}
+
+	e := &Edge{Path: [2]image.Point{s.Foot, s.Road}, Sections: []*Section{{Path: [2]image.Point{s.Foot, s.Road}}}}
+	r := c.RoadNetwork.add(e, 1, ConnectorRoad)
+	for _, p := range []image.Point{s.Foot, s.Road} {
+		if d, ok := c.cellToDist[c.graph.SiteFor(p.X, p.Y).ID()]; ok {
+			c.shareRoad(r, d)
+		}
+	}
+	return r.ID
+}
+
+// stairAt returns a stair (of the given length & depth) against the inside
+// face of the ith wall of ring r, centred `along` pixels from the start of
+// the wall, if one fits there & there is a road near by
+func (c *Citygraph) stairAt(r *WallRing, i int, along float64, length, depth int) *Stair {
+	a, b := r.Vertices[i], r.Vertices[(i+1)%len(r.Vertices)]
+	ux, uy, l := unitVector(a, b)
+	half := float64(length) / 2
+	if l == 0 || along-half < 0 || along+half > l {
+		return nil
+	}
+	nx, ny := -uy, ux
+	at := func(along, across float64) image.Point {
+		return image.Pt(
+			a.X+int(math.Round(ux*along+nx*across)),
+			a.Y+int(math.Round(uy*along+ny*across)),
+		)
+	}
+
+	mid := at(along, 0)
+	if !c.cmap.isFortification(mid.X, mid.Y) {
+		return nil // the wall isn't drawn here (ie. it's been orthogonalised)
+	}
+
+	// work out which side of the wall is inside & how far the wall reaches
+	districts := map[int]bool{}
+	for _, id := range r.Districts {
+		districts[id] = true
+	}
+	limit := c.maxWallWidth() + c.largestTowerSize()
+	face := 0.0
+	for _, side := range []float64{1, -1} {
+		s := 1
+		for ; s <= limit; s++ {
+			q := at(along, side*float64(s))
+			if !c.cmap.isFortification(q.X, q.Y) {
+				break
+			}
+		}
+		q := at(along, side*float64(s))
+		if s <= limit && q.In(c.cfg.Area) && districts[c.graph.SiteFor(q.X, q.Y).ID()] {
+			face = side * float64(s)
+			break
+		}
+	}
+	if face == 0 {
+		return nil
+	}
+	inward := face / math.Abs(face)
+	back := face + inward*float64(depth)
+
+	poly := []image.Point{at(along-half, face), at(along+half, face), at(along+half, back), at(along-half, back)}
+	pnts := polygonPixels(poly)
+	if len(pnts) == 0 {
+		return nil
+	}
+	for _, p := range pnts {
+		if !p.In(c.cfg.Area) || !c.outline.CanBuildOn(p.X, p.Y) || c.cmap.isFortification(p.X, p.Y) {
+			return nil
+		}
+		if !c.cmap.isBlank(p.X, p.Y) {
+			return nil // ie. a road, plaza or the like
+		}
+	}
+
+	// the foot of the stair is whichever end is nearer a road
+	centre := face + inward*float64(depth)/2
+	ends := [2]image.Point{at(along-half+1, centre), at(along+half-1, centre)}
+	var road *image.Point
+	foot := -1
+	for k, e := range ends {
+		if p := c.nearestRoadPixel(e, length); p != nil && c.clearPath(e, *p) && (road == nil || calculateDist(e.X, e.Y, p.X, p.Y) < calculateDist(ends[foot].X, ends[foot].Y, road.X, road.Y)) {
+			road, foot = p, k
+		}
+	}
+	if road == nil {
+		return nil
+	}
+
+	top := ends[1-foot]
+	direction := math.Atan2(float64(top.X-ends[foot].X), float64(ends[foot].Y-top.Y)) * 180 / math.Pi
+	if direction < 0 {
+		direction += 360
+	}
+
+	return &Stair{
+		Polygon:   poly,
+		Foot:      ends[foot],
+		Top:       top,
+		Direction: direction,
+		Road:      *road,
+	}
+}
+
+// nearestRoadPixel returns the nearest road pixel to p within reach
+func (c *Citygraph) nearestRoadPixel(p image.Point, reach int) *image.Point {
+	var best *image.Point
+	bestDist := math.Inf(1)
+	for dy := -reach; dy <= reach; dy++ {
+		for dx := -reach; dx <= reach; dx++ {
+			q := image.Pt(p.X+dx, p.Y+dy)
+			if !q.In(c.cfg.Area) || !c.cmap.IsRoad(q.X, q.Y) {
+				continue
+			}
+			if d := math.Hypot(float64(dx), float64(dy)); d < bestDist {
+				best, bestDist = &q, d
+			}
+		}
+	}
+	return best
+}
+
+// clearPath returns if a path can be drawn from a to b, ie. every pixel
+// between them is either road or clear land
+func (c *Citygraph) clearPath(a, b image.Point) bool {
+	for _, p := range line.PointsBetween(a, b) {
+		if c.cmap.IsRoad(p.X, p.Y) {
+			continue
+		}
+		if !p.In(c.cfg.Area) || !c.outline.CanBuildOn(p.X, p.Y) || !c.cmap.isBlank(p.X, p.Y) {
+			return false
+		}
+	}
+	return true
+}
+
+// nearestSegment returns the index of the wall of ring r nearest p & how
+// far along it (in pixels) p is
+func nearestSegment(r *WallRing, p image.Point) (int, float64) {
+	best, bestDist, bestAlong := -1, math.Inf(1), 0.0
+	for i := range r.Vertices {
+		a, b := r.Vertices[i], r.Vertices[(i+1)%len(r.Vertices)]
+		if d := distToSegment(p, a, b); d < bestDist {
+			t := math.Max(0, math.Min(1, projection(a, b, p)))
+			best, bestDist, bestAlong = i, d, t*calculateDist(a.X, a.Y, b.X, b.Y)
+		}
+	}
+	return best, bestAlong
+}
+
+// mid returns the middle of the stair
+func (s *Stair) mid() image.Point {
+	return image.Pt((s.Foot.X+s.Top.X)/2, (s.Foot.Y+s.Top.Y)/2)
+}
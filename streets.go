@@ -0,0 +1,394 @@
+package citygraph
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+var (
+	// words we add to street names to tell apart streets with the same name
+	streetQualifiers = []string{"Little", "Great", "Old", "New", "Upper", "Lower", "Back", "Middle"}
+)
+
+const (
+	// the sharpest turn (in degrees) that a street can take through a junction
+	maxStreetTurn = 45.0
+
+	// how far (in pixels) from a building we'll look for a street
+	addressSearchRadius = 32
+)
+
+// Street is a named run of one or more roads that (roughly) carry straight
+// on through the junctions between them.
+type Street struct {
+	ID        int
+	Name      string
+	Hierarchy RoadHierarchy
+
+	// IDs of roads in order from one end of the street to the other
+	Roads []int
+
+	// true for each road (above) that runs from Path[1] to Path[0] along the street
+	reversed []bool
+}
+
+// WordListNamer is a StreetNamer that builds names from a word & a suffix,
+// ie. "Tanner's" + "Row".
+type WordListNamer struct {
+	// Words by district type, Fallback is used for any type not given
+	Words    map[DistrictType][]string
+	Fallback []string
+
+	// Suffixes by road hierarchy, FallbackSuffixes is used for any hierarchy
+	// not given
+	Suffixes         map[RoadHierarchy][]string
+	FallbackSuffixes []string
+}
+
+// StreetName returns a random word & suffix for the given district / road type
+func (w *WordListNamer) StreetName(district DistrictType, h RoadHierarchy, rng *rand.Rand) string {
+	words, ok := w.Words[district]
+	if !ok || len(words) == 0 {
+		words = w.Fallback
+	}
+	suffixes, ok := w.Suffixes[h]
+	if !ok || len(suffixes) == 0 {
+		suffixes = w.FallbackSuffixes
+	}
+	if len(words) == 0 || len(suffixes) == 0 {
+		return ""
+	}
+	return words[rng.Intn(len(words))] + " " + suffixes[rng.Intn(len(suffixes))]
+}
+
+// DefaultStreetNamer returns a WordListNamer with some (vaguely old world) names
+func DefaultStreetNamer() *WordListNamer {
+	return &WordListNamer{
+		Words: map[DistrictType][]string{
+			Park:              {"Elm", "Willow", "Meadow", "Rose", "Linden", "Oak"},
+			Temple:            {"Saint's", "Chantry", "Pilgrim's", "Bell", "Abbey", "Candle"},
+			Civic:             {"Guildhall", "Court", "Assize", "Mayor's", "Chancery"},
+			Graveyard:         {"Mourner's", "Yew", "Sexton's", "Lych"},
+			ResidentialUpper:  {"King's", "Queen's", "Crown", "Regent", "Lord's", "Silver"},
+			ResidentialMiddle: {"Baker's", "Mercer's", "Chandler's", "Draper's", "Brewer's"},
+			ResidentialLower:  {"Weaver's", "Potter's", "Cobbler's", "Fuller's", "Dyer's"},
+			ResidentialSlum:   {"Rat", "Beggar's", "Mud", "Gutter", "Rag"},
+			Abandoned:         {"Ash", "Cinder", "Hollow", "Blind"},
+			Fortress:          {"Castle", "Keep", "Garrison", "Bailey"},
+			Market:            {"Market", "Corn", "Fish", "Hay", "Cheap"},
+			Commercial:        {"Cloth", "Spice", "Goldsmith's", "Vintner's", "Hatter's"},
+			Square:            {"Fountain", "Cross", "Well", "Statue"},
+			Industrial:        {"Tanner's", "Smith's", "Cooper's", "Forge", "Mill", "Skinner's"},
+			Warehouse:         {"Bonded", "Wool", "Salt", "Timber"},
+			Barracks:          {"Soldier's", "Drill", "Archer's", "Sergeant's"},
+			Prison:            {"Gallows", "Gaol", "Chain", "Warden's"},
+			Docks:             {"Anchor", "Wharf", "Sailor's", "Rope", "Harbour"},
+			Research:          {"Scholar's", "College", "Scribe's", "Alchemist's"},
+			Fields:            {"Barley", "Plough", "Orchard", "Shepherd's", "Mill"},
+		},
+		Fallback: []string{"Long", "Narrow", "High", "Low", "Old", "New"},
+		Suffixes: map[RoadHierarchy][]string{
+			ArterialRoad:  {"Way", "Road", "Gate"},
+			MainRoad:      {"Street", "Road", "Lane"},
+			MinorRoad:     {"Row", "Lane", "Alley", "Close", "Walk", "Yard"},
+			WallSideRoad:  {"Wall", "Rampart"},
+			ConnectorRoad: {"Passage", "Steps", "Cut"},
+		},
+		FallbackSuffixes: []string{"Street"},
+	}
+}
+
+// roadEnd is one end of a road, either the start (Path[0] end) or finish
+type roadEnd struct {
+	road  int
+	start bool
+}
+
+// direction returns a unit vector pointing away from this end of the road
+func (e roadEnd) direction(n *RoadNetwork) (float64, float64) {
+	a, b, _ := n.Roads[e.road].ends()
+	if !e.start {
+		a, b = b, a
+	}
+	dx, dy := float64(b.X-a.X), float64(b.Y-a.Y)
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return 0, 0
+	}
+	return dx / length, dy / length
+}
+
+// buildStreets groups roads into streets. At each junction roads of the same
+// hierarchy are paired off (straightest first) if they carry on in roughly
+// the same direction; each chain of paired roads is a street.
+func (n *RoadNetwork) buildStreets() {
+	n.Streets = []*Street{}
+	limit := -math.Cos(maxStreetTurn * math.Pi / 180)
+
+	next := map[roadEnd]roadEnd{}
+	for _, j := range n.Junctions {
+		ends := []roadEnd{}
+		for _, id := range j.Roads {
+			r := n.Roads[id]
+			if len(r.Junctions) == 0 {
+				continue
+			}
+			if r.Junctions[0] == j.ID {
+				ends = append(ends, roadEnd{road: id, start: true})
+			} else if r.Junctions[len(r.Junctions)-1] == j.ID {
+				ends = append(ends, roadEnd{road: id, start: false})
+			}
+		}
+
+		type pairing struct {
+			a, b  roadEnd
+			score float64
+		}
+		pairs := []*pairing{}
+		for i := 0; i < len(ends); i++ {
+			for k := i + 1; k < len(ends); k++ {
+				a, b := ends[i], ends[k]
+				if a.road == b.road || n.Roads[a.road].Hierarchy != n.Roads[b.road].Hierarchy {
+					continue
+				}
+				ax, ay := a.direction(n)
+				bx, by := b.direction(n)
+				score := ax*bx + ay*by // -1 where the roads point in opposite directions
+				if score > limit {
+					continue
+				}
+				pairs = append(pairs, &pairing{a: a, b: b, score: score})
+			}
+		}
+		sort.SliceStable(pairs, func(i, k int) bool { return pairs[i].score < pairs[k].score })
+
+		used := map[roadEnd]bool{}
+		for _, p := range pairs {
+			if used[p.a] || used[p.b] {
+				continue
+			}
+			used[p.a], used[p.b] = true, true
+			next[p.a] = p.b
+			next[p.b] = p.a
+		}
+	}
+
+	seen := map[int]bool{}
+	walk := func(from roadEnd) {
+		s := &Street{ID: len(n.Streets), Hierarchy: n.Roads[from.road].Hierarchy, Roads: []int{}, reversed: []bool{}}
+		for current := from; !seen[current.road]; {
+			seen[current.road] = true
+			s.Roads = append(s.Roads, current.road)
+			s.reversed = append(s.reversed, !current.start)
+
+			// we leave each road by the opposite end to the one we came in by
+			after, ok := next[roadEnd{road: current.road, start: !current.start}]
+			if !ok {
+				break
+			}
+			current = after
+		}
+		n.Streets = append(n.Streets, s)
+	}
+
+	// start from the ends of streets, then handle any that loop around
+	for _, r := range n.Roads {
+		if seen[r.ID] || len(r.Junctions) == 0 {
+			continue
+		}
+		if _, ok := next[roadEnd{road: r.ID, start: true}]; !ok {
+			walk(roadEnd{road: r.ID, start: true})
+		} else if _, ok := next[roadEnd{road: r.ID, start: false}]; !ok {
+			walk(roadEnd{road: r.ID, start: false})
+		}
+	}
+	for _, r := range n.Roads {
+		if !seen[r.ID] && len(r.Junctions) > 0 {
+			walk(roadEnd{road: r.ID, start: true})
+		}
+	}
+}
+
+// nameStreets groups roads into streets, names them & gives each building
+// an address
+func (c *Citygraph) nameStreets() {
+	n := c.RoadNetwork
+	n.buildStreets()
+
+	used := map[string]bool{}
+	for _, s := range n.Streets {
+		dtype := c.streetDistrict(s)
+
+		name := ""
+		for i := 0; i < 10; i++ {
+			name = c.cfg.StreetNamer.StreetName(dtype, s.Hierarchy, c.rng)
+			if !used[name] {
+				break
+			}
+		}
+		if name == "" {
+			continue
+		}
+		if used[name] {
+			// we'd rather not have two streets with the same name, so that
+			// addresses are unique
+			base := name
+			for i, q := range streetQualifiers {
+				name = q + " " + base
+				if !used[name] {
+					break
+				}
+				if i == len(streetQualifiers)-1 {
+					name = fmt.Sprintf("%s %d", base, s.ID)
+				}
+			}
+		}
+		used[name] = true
+
+		s.Name = name
+		for _, id := range s.Roads {
+			n.Roads[id].Street = name
+		}
+	}
+
+	c.addressBuildings()
+}
+
+// streetDistrict returns the type of district that most roads of the street
+// border / run through
+func (c *Citygraph) streetDistrict(s *Street) DistrictType {
+	counts := map[int]int{}
+	for _, id := range s.Roads {
+		for _, d := range c.RoadNetwork.Roads[id].Districts {
+			counts[d]++
+		}
+	}
+
+	best := -1
+	for id, count := range counts {
+		if best < 0 || count > counts[best] || (count == counts[best] && id < best) {
+			best = id
+		}
+	}
+
+	d, ok := c.cellToDist[best]
+	if !ok {
+		return Empty
+	}
+	return d.Type
+}
+
+// addressBuildings gives every building the name of it's nearest street & a
+// house number. Numbers run from one end of the street to the other, odd
+// numbers on the left & even numbers on the right.
+func (c *Citygraph) addressBuildings() {
+	n := c.RoadNetwork
+
+	// how far along it's street each road starts
+	offsets := map[int]float64{}
+	for _, s := range n.Streets {
+		total := 0.0
+		for _, id := range s.Roads {
+			offsets[id] = total
+			a, b, _ := n.Roads[id].ends()
+			total += calculateDist(a.X, a.Y, b.X, b.Y)
+		}
+	}
+	reversed := map[int]bool{}
+	streetOf := map[int]*Street{}
+	for _, s := range n.Streets {
+		for i, id := range s.Roads {
+			reversed[id] = s.reversed[i]
+			streetOf[id] = s
+		}
+	}
+
+	type house struct {
+		b    *Building
+		pos  float64
+		left bool
+	}
+	houses := map[int][]*house{}
+
+	for _, d := range c.Districts {
+		for _, b := range d.Buildings {
+			r := c.nearestRoad(b.Area, addressSearchRadius)
+			if r == nil {
+				continue
+			}
+			s, ok := streetOf[r.ID]
+			if !ok || s.Name == "" {
+				continue
+			}
+
+			a, z, _ := r.ends()
+			if reversed[r.ID] {
+				a, z = z, a
+			}
+			centre := image.Pt((b.Area.Min.X+b.Area.Max.X)/2, (b.Area.Min.Y+b.Area.Max.Y)/2)
+			along := math.Max(0, math.Min(1, projection(a, z, centre))) * calculateDist(a.X, a.Y, z.X, z.Y)
+			cross := (z.X-a.X)*(centre.Y-a.Y) - (z.Y-a.Y)*(centre.X-a.X)
+
+			houses[s.ID] = append(houses[s.ID], &house{b: b, pos: offsets[r.ID] + along, left: cross < 0})
+		}
+	}
+
+	for _, s := range n.Streets {
+		hs := houses[s.ID]
+		sort.SliceStable(hs, func(i, k int) bool { return hs[i].pos < hs[k].pos })
+
+		odd, even := 1, 2
+		for _, h := range hs {
+			h.b.Street = s.Name
+			if h.left {
+				h.b.Number = odd
+				odd += 2
+			} else {
+				h.b.Number = even
+				even += 2
+			}
+		}
+	}
+}
+
+// nearestRoad returns the closest road to the given area, searching outward
+// up to `radius` pixels
+func (c *Citygraph) nearestRoad(area image.Rectangle, radius int) *Road {
+	centre := image.Pt((area.Min.X+area.Max.X)/2, (area.Min.Y+area.Max.Y)/2)
+
+	for ring := 1; ring <= radius; ring++ {
+		bnds := area.Inset(-ring)
+
+		var found *Road
+		best := -1.0
+		check := func(x, y int) {
+			r := c.RoadNetwork.RoadAt(x, y)
+			if r == nil {
+				return
+			}
+			d := calculateDist(centre.X, centre.Y, x, y)
+			if best < 0 || d < best {
+				best = d
+				found = r
+			}
+		}
+
+		for x := bnds.Min.X; x < bnds.Max.X; x++ {
+			check(x, bnds.Min.Y)
+			check(x, bnds.Max.Y-1)
+		}
+		for y := bnds.Min.Y + 1; y < bnds.Max.Y-1; y++ {
+			check(bnds.Min.X, y)
+			check(bnds.Max.X-1, y)
+		}
+
+		if found != nil {
+			return found
+		}
+	}
+
+	return nil
+}
@@ -44,6 +44,9 @@ type District struct {
 	// Centre of district (voronoi site)
 	Site image.Point
 
+	// arbitrary metadata from the DistrictConfig & DistrictSite (if any)
+	Tags map[string]string `json:",omitempty"`
+
 	// buildings in this district
 	Buildings []*Building `json:",omitempty"`
 	Central   *Building   `json:",omitempty"`
@@ -60,6 +63,13 @@ type District struct {
 	Walls  []*Edge           `json:",omitempty"`
 	Towers []image.Rectangle `json:",omitempty"`
 	Gates  []image.Rectangle `json:",omitempty"`
+
+	// outworks of the curtain wall (see FortificationSettings.Style)
+	Bastions []*Outwork `json:",omitempty"`
+	Ravelins []*Outwork `json:",omitempty"`
+
+	// the curtain wall as an ordered ring (see WallRing)
+	WallRings []*WallRing `json:",omitempty"`
 }
 
 // Edge represents a complete line along Path that is broken into
@@ -73,12 +83,47 @@ type District struct {
 type Edge struct {
 	Path     [2]image.Point
 	Sections []*Section
+
+	// name of the street this edge is part of (see CityConfig.StreetNamer)
+	Street string `json:",omitempty"`
+
+	// true if this is part of a road leading out of the city
+	// (see CityConfig.ExternalConnections)
+	External bool `json:",omitempty"`
 }
 
+// SectionKind describes a section that isn't simply a road or a bridge
+type SectionKind string
+
+const (
+	FordSection  SectionKind = "ford"  // a road through shallow water
+	FerrySection SectionKind = "ferry" // a boat crossing between two landings
+
+	DrawbridgeSection SectionKind = "drawbridge" // a bridge over a moat in front of a gate
+)
+
 // Section is a piece of an edge
 type Section struct {
 	Path   [2]image.Point
-	Bridge bool `json:",omitempty"`
+	Bridge bool        `json:",omitempty"`
+	Kind   SectionKind `json:",omitempty"`
+
+	// Curve is set if the section isn't drawn as a straight line (see
+	// CityConfig.MainRoadWiggle), in which case it holds every point that the
+	// section passes through, from Path[0] to Path[1].
+	Curve []image.Point `json:",omitempty"`
+}
+
+// lines returns the straight line(s) that make up the section
+func (s *Section) lines() [][2]image.Point {
+	if len(s.Curve) < 2 {
+		return [][2]image.Point{s.Path}
+	}
+	lines := [][2]image.Point{}
+	for i := 1; i < len(s.Curve); i++ {
+		lines = append(lines, [2]image.Point{s.Curve[i-1], s.Curve[i]})
+	}
+	return lines
 }
 
 // Building represents an area of land for a given purpose / structure.
@@ -86,8 +131,25 @@ type Section struct {
 // is the same size (naturally the Area.Min here is unique & tells us
 // the top-left corner of the building location)
 type Building struct {
-	ID   int
+	ID int
+
+	// the rectangle the building was placed in. Other buildings may fill in
+	// around a Footprint (ie. in a courtyard), so these may overlap.
 	Area image.Rectangle
+
+	// the shape of the building within it's Area, if it doesn't take up
+	// the whole rectangle (see BuildingConfig.Footprint). This is shared by
+	// all buildings of the same ID so isn't repeated in JSON, see
+	// Citygraph.Footprints
+	Footprint *Footprint `json:"-"`
+
+	// arbitrary metadata from the BuildingConfig (see BuildingConfig.Tags)
+	Tags map[string]string `json:",omitempty"`
+
+	// address of the building; the nearest street & the house number along
+	// it (see CityConfig.StreetNamer)
+	Street string `json:",omitempty"`
+	Number int    `json:",omitempty"`
 }
 
 // DistrictStats holds generic stats about the district
@@ -98,6 +160,7 @@ type DistrictStats struct {
 	Bridgeable   int `json:",omitempty"`
 
 	// counts of interesting features, buildings by ID (see BuildingConfig)
+	// & road bridges (on any sort of road) whose middle is in the district
 	BuildingsByID map[int]int `json:",omitempty"`
 	Bridges       int         `json:",omitempty"`
 }
@@ -111,7 +174,7 @@ func (d *District) addBuilding(x, y int, b *BuildingConfig) *Building {
 	count, _ := d.Stats.BuildingsByID[b.ID]
 	d.Stats.BuildingsByID[b.ID] = count + 1
 
-	build := &Building{ID: b.ID, Area: image.Rect(x, y, b.Area.Max.X-b.Area.Min.X, b.Area.Max.Y-b.Area.Min.Y)}
+	build := &Building{ID: b.ID, Area: b.Area.Add(image.Pt(x, y)), Footprint: b.Footprint, Tags: copyTags(b.Tags)}
 	d.Buildings = append(d.Buildings, build)
 
 	return build
@@ -0,0 +1,136 @@
+package citygraph
+
+import (
+	"image"
+	"math"
+
+	"github.com/voidshard/citygraph/internal/cell"
+)
+
+// defaultCornerAngle see FortificationSettings.CornerAngle
+const defaultCornerAngle = 30.0
+
+// cornerTowerArea returns the dimensions of towers at the corners of walls
+// (see FortificationSettings.CornerTowerArea)
+func (c *Citygraph) cornerTowerArea() image.Rectangle {
+	f := c.cfg.Fortifications
+	if f.CornerTowerArea.Empty() {
+		return f.TowerArea
+	}
+	return f.CornerTowerArea
+}
+
+// gateTowerArea returns the dimensions of towers flanking gates
+// (see FortificationSettings.GateTowerArea)
+func (c *Citygraph) gateTowerArea() image.Rectangle {
+	f := c.cfg.Fortifications
+	if f.GateTowerArea.Empty() {
+		return f.TowerArea
+	}
+	return f.GateTowerArea
+}
+
+// largestTowerSize returns the largest width or height of any kind of tower
+func (c *Citygraph) largestTowerSize() int {
+	size := 0
+	for _, t := range []image.Rectangle{c.cfg.Fortifications.TowerArea, c.cornerTowerArea(), c.gateTowerArea()} {
+		size = maxint(size, maxint(t.Dx(), t.Dy()))
+	}
+	return size
+}
+
+// wallCorner is a vertex where a wall turns sharply enough that we want a
+// tower on it (see FortificationSettings.CornerAngle)
+type wallCorner struct {
+	at image.Point
+
+	// directions & lengths of the walls leaving the corner
+	along   [2][2]float64
+	lengths [2]float64
+}
+
+// wallCorners returns the corners of the wall (as returned by cell.Circut).
+// The ends of the wall (where it runs up against another) aren't corners.
+func (c *Citygraph) wallCorners(wall [][2]image.Point) []*wallCorner {
+	angle := c.cfg.Fortifications.CornerAngle
+	if angle <= 0 {
+		angle = defaultCornerAngle
+	}
+
+	corners := []*wallCorner{}
+	for _, r := range cell.Rings(wall) {
+		n := len(r.Vertices)
+		if n < 3 {
+			continue
+		}
+		open := map[int]bool{}
+		for _, i := range r.Open {
+			open[i] = true
+		}
+
+		for i, v := range r.Vertices {
+			prev := (i + n - 1) % n
+			if open[i] || open[prev] {
+				continue
+			}
+			ax, ay, la := unitVector(v, r.Vertices[prev])
+			bx, by, lb := unitVector(v, r.Vertices[(i+1)%n])
+			if la == 0 || lb == 0 {
+				continue
+			}
+
+			// a wall running straight on has 180 degrees between it's walls
+			between := math.Acos(math.Max(-1, math.Min(1, ax*bx+ay*by))) * 180 / math.Pi
+			if 180-between < angle {
+				continue
+			}
+			corners = append(corners, &wallCorner{
+				at:      v,
+				along:   [2][2]float64{{ax, ay}, {bx, by}},
+				lengths: [2]float64{la, lb},
+			})
+		}
+	}
+
+	return corners
+}
+
+// candidates returns places we could put the corner tower, best first; the
+// corner itself & then stepping out along each wall up to reach pixels (or
+// half way along the wall, if that's nearer)
+func (w *wallCorner) candidates(reach int) []image.Point {
+	pnts := []image.Point{w.at}
+	for d := 1; d <= reach; d++ {
+		for i, u := range w.along {
+			if float64(d) > w.lengths[i]/2 {
+				continue
+			}
+			pnts = append(pnts, image.Pt(
+				w.at.X+int(math.Round(u[0]*float64(d))),
+				w.at.Y+int(math.Round(u[1]*float64(d))),
+			))
+		}
+	}
+	return pnts
+}
+
+// towerNear returns if any of the towers are within dist of p
+func towerNear(p image.Point, dist int, towers []image.Rectangle) bool {
+	for _, t := range towers {
+		if p.In(t.Inset(-dist)) {
+			return true
+		}
+	}
+	return false
+}
+
+// nearGate returns if p is within dist of any of the gatehouses (or within
+// their courtyards)
+func nearGate(gates map[string]*gateLocation, p image.Point, dist int) bool {
+	for _, g := range gates {
+		if g.withinGateCourtyard(p) || p.In(g.Gatehouse.Inset(-dist)) {
+			return true
+		}
+	}
+	return false
+}
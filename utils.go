@@ -30,20 +30,43 @@ type gateLocation struct {
 	// the left & right points where we "cut" the wall
 	Left  image.Point
 	Right image.Point
+
+	// 0 for the main city wall (or curtain walls), otherwise the
+	// index+1 of the inner ring (see FortificationSettings.Rings)
+	ring int
+
+	// the ravelin in front of the gate, if any (see FortificationSettings.Ravelins)
+	ravelin []*Outwork
+
+	// why we chose this location (see gateScorer)
+	score  float64
+	reason string
+}
+
+// mid returns the middle of the edge the gate is placed on
+func (g *gateLocation) mid() image.Point {
+	return image.Pt((g.Edge[0].X+g.Edge[1].X)/2, (g.Edge[0].Y+g.Edge[1].Y)/2)
+}
+
+// scored returns the gate's score for export
+func (g *gateLocation) scored() *GateScore {
+	return &GateScore{Gate: g.Gatehouse, Score: g.score, Reason: g.reason}
 }
 
 // withinGateCourtyard returns if the given point is directly infront of the gate
-// within the wall indentation
+// within the wall indentation.
+// We allow a pixel either way since Left / Right are rounded, which otherwise
+// matters for (nearly) vertical or horizontal walls.
 func (g *gateLocation) withinGateCourtyard(in image.Point) bool {
 	a, b := g.Left, g.Right
-	if in.X < a.X || in.X > b.X {
+	if in.X < a.X-1 || in.X > b.X+1 {
 		return false
 	}
 
 	if b.Y < a.Y {
 		a, b = b, a
 	}
-	if in.Y < a.Y || in.Y > b.Y {
+	if in.Y < a.Y-1 || in.Y > b.Y+1 {
 		return false
 	}
 
@@ -96,7 +119,9 @@ func (g *gateLocation) determinePlacements(graph *voronoi.Voronoi, tower, gate i
 		left := image.Pt(int(lx), int(ly))
 		right := image.Pt(int(rx), int(ry))
 
-		if right.X < left.X {
+		// compare before rounding; on steep edges both ends can round to
+		// the same X & we'd get left & right the wrong way around
+		if rx < lx {
 			left, right = right, left
 		}
 
@@ -217,6 +242,9 @@ type districtBuilder struct {
 	total float64
 	must  []*BuildingConfig
 	count map[int]int
+
+	// min distance between buildings (see Placer.SetSpacing)
+	spacing int
 }
 
 // newDistrictBuilder preps a builder to begin picking buildings.
@@ -250,18 +278,13 @@ func newDistrictBuilder(seed int64, o Outline, d *District, c *DistrictConfig, s
 // Max numbers are respected & probabilities of buildings used.
 // Despite this it's often easier to place smaller buildings, so probabilities
 // may wish to weight larger buildings slightly higher in general than strictly desired.
+// Nothing is recorded until the building is placed (see placedBuilding).
 func (d *districtBuilder) chooseBuilding(x, y int) *BuildingConfig {
-	for i, b := range d.must {
+	for _, b := range d.must {
 		// attempt to place buildings we *must* place first
-		if !d.buildingFits(x, y, b) {
-			continue
+		if d.buildingFits(x, y, b) {
+			return b
 		}
-		d.must = append(d.must[:i], d.must[i+1:]...)
-
-		num, _ := d.count[b.ID]
-		d.count[b.ID] = num + 1
-
-		return b
 	}
 
 	rv := d.rng.Float64()
@@ -284,7 +307,6 @@ func (d *districtBuilder) chooseBuilding(x, y int) *BuildingConfig {
 		}
 
 		if sofar > rv {
-			d.count[b.ID] = num + 1
 			return b
 		}
 	}
@@ -292,13 +314,29 @@ func (d *districtBuilder) chooseBuilding(x, y int) *BuildingConfig {
 	return nil
 }
 
+// placedBuilding records that b has been placed, counting it towards it's
+// MaxInDistrict & (if we still must place one) it's MinInDistrict
+func (d *districtBuilder) placedBuilding(b *BuildingConfig) {
+	for i, m := range d.must {
+		if m == b {
+			d.must = append(d.must[:i], d.must[i+1:]...)
+			break
+		}
+	}
+	d.count[b.ID]++
+}
+
 // buildingFits returns if the building b fits at (ox,oy) (top left)
 func (d *districtBuilder) buildingFits(ox, oy int, b *BuildingConfig) bool {
 	for x := b.Area.Min.X; x < b.Area.Max.X; x++ {
 		// nb. we pad top & bottom by 1 tile so buildings can't run together
 		// top to bottom (but they can sit right next to each other in x terms)
 		for y := b.Area.Min.Y - 1; y < b.Area.Max.Y+1; y++ {
-			if d.cm.IsRoad(x+ox, y+oy) || d.cm.IsBridge(x+ox, y+oy) || d.cm.IsWall(x+ox, y+oy) || d.cm.IsTower(x+ox, y+oy) || d.cm.IsGatehouse(x+ox, y+oy) {
+			// nb. we only need the pixels the building stands on (see Footprint)
+			if !b.covers(x, y) && !b.covers(x, y-1) && !b.covers(x, y+1) {
+				continue
+			}
+			if d.cm.IsRoad(x+ox, y+oy) || d.cm.IsBridge(x+ox, y+oy) || d.cm.IsFord(x+ox, y+oy) || d.cm.IsFerry(x+ox, y+oy) || d.cm.IsPlaza(x+ox, y+oy) || d.cm.IsAlley(x+ox, y+oy) || d.cm.IsMoat(x+ox, y+oy) || d.cm.IsPostern(x+ox, y+oy) || d.cm.IsStairs(x+ox, y+oy) || d.cm.IsWall(x+ox, y+oy) || d.cm.IsTower(x+ox, y+oy) || d.cm.IsGatehouse(x+ox, y+oy) {
 				return false
 			}
 			bID, _ := d.cm.BuildingID(x+ox, y+oy)
@@ -311,6 +349,16 @@ func (d *districtBuilder) buildingFits(ox, oy int, b *BuildingConfig) bool {
 			return false
 		}
 	}
+	if d.spacing <= 0 {
+		return true
+	}
+	for y := b.Area.Min.Y - d.spacing; y < b.Area.Max.Y+d.spacing; y++ {
+		for x := b.Area.Min.X - d.spacing; x < b.Area.Max.X+d.spacing; x++ {
+			if bID, err := d.cm.BuildingID(x+ox, y+oy); err == nil && bID != 0 {
+				return false
+			}
+		}
+	}
 	return true
 }
 
@@ -345,3 +393,70 @@ func maxint(a, b int) int {
 	}
 	return b
 }
+
+// minint returns the lowest of two ints
+func minint(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// edgeID returns a string ID for the line (a,b) that is the same regardless
+// of the order the points are given in
+func edgeID(a, b image.Point) string {
+	if b.X < a.X {
+		a, b = b, a
+	} else if a.X == b.X && b.Y < a.Y {
+		a, b = b, a
+	}
+	return fmt.Sprintf("%d,%d-%d,%d", a.X, a.Y, b.X, b.Y)
+}
+
+// projection returns how far along the line (a,b) the point p sits, where
+// 0 is at a and 1 is at b (p need not be on the line, values may exceed 0-1)
+func projection(a, b, p image.Point) float64 {
+	dx := float64(b.X - a.X)
+	dy := float64(b.Y - a.Y)
+	lsq := dx*dx + dy*dy
+	if lsq == 0 {
+		return 0
+	}
+	return (float64(p.X-a.X)*dx + float64(p.Y-a.Y)*dy) / lsq
+}
+
+// distToSegment returns the shortest distance from p to the line segment (a,b)
+func distToSegment(p, a, b image.Point) float64 {
+	t := math.Max(0, math.Min(1, projection(a, b, p)))
+	x := float64(a.X) + t*float64(b.X-a.X)
+	y := float64(a.Y) + t*float64(b.Y-a.Y)
+	return math.Hypot(float64(p.X)-x, float64(p.Y)-y)
+}
+
+// segmentBounds returns a rectangle containing the line (a,b) padded by pad
+func segmentBounds(a, b image.Point, pad int) image.Rectangle {
+	r := image.Rect(a.X, a.Y, b.X, b.Y)
+	r.Max = r.Max.Add(image.Pt(1, 1)) // include the end point(s)
+	return r.Inset(-pad)
+}
+
+// absint returns the absolute value of an int
+func absint(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// copyTags returns a copy of the given tags (see BuildingConfig.Tags) so
+// that each Building / District has it's own
+func copyTags(in map[string]string) map[string]string {
+	if len(in) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(in))
+	for k, v := range in {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,148 @@
+package citygraph
+
+import (
+	"image"
+	"sort"
+
+	"github.com/voidshard/citygraph/internal/line"
+)
+
+// WallRepair records a gap in a wall that we found & closed (see
+// Citygraph.WallRepairs)
+type WallRepair struct {
+	// the piece of wall we drew to close the gap
+	Path [2]image.Point
+
+	// the tower we added, if the gap was at a vertex of the wall
+	Tower *image.Rectangle `json:",omitempty"`
+}
+
+// wallGap is a break in a wall that we've drawn
+type wallGap struct {
+	path [2]image.Point
+
+	// the edge of the wall with the gap, or nil if the gap is between edges
+	edge *Edge
+
+	// set if the gap is at a vertex of the wall
+	vertex *image.Point
+}
+
+// wallGaps walks the wall(s) we've drawn along each of the edges & returns
+// any breaks in them that aren't gates or water we aren't allowed to wall
+// over (see MaxBridgeWallLength). We also return gaps between the ends of
+// edges that don't quite meet.
+func (c *Citygraph) wallGaps(edges []*Edge, gates map[string]*gateLocation, width int) []*wallGap {
+	gaps := []*wallGap{}
+
+	inGate := func(p image.Point) bool {
+		for _, g := range gates {
+			if g.withinGateCourtyard(p) || p.In(g.Gatehouse.Inset(-1)) {
+				return true
+			}
+			for _, t := range g.Towers {
+				if p.In(t.Inset(-1)) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	// nb. we ignore pixels we couldn't have built on in the first place, or
+	// that are closed by a chain (see WaterCrossing)
+	wallable := func(p image.Point) bool {
+		return p.In(c.cfg.Area) && !inGate(p) && !c.nearChain(p) && (c.outline.CanBuildOn(p.X, p.Y) || c.outline.CanBridgeOver(p.X, p.Y))
+	}
+
+	// the wall may list the same segment twice, so we dedupe as we go
+	seen := map[string]bool{}
+	ends := map[image.Point]int{}
+	for _, e := range edges {
+		id := edgeID(e.Path[0], e.Path[1])
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		ends[e.Path[0]]++
+		ends[e.Path[1]]++
+
+		pnts := []image.Point{}
+		for _, l := range orthogonalise(e.Path[0], e.Path[1], c.cfg.RoadMode) {
+			pnts = append(pnts, line.PointsBetween(l[0], l[1])...)
+		}
+
+		// collect runs of pixels missing their wall
+		run := []image.Point{}
+		flush := func() {
+			if len(run) == 0 {
+				return
+			}
+			water := 0
+			for _, p := range run {
+				if !c.outline.CanBuildOn(p.X, p.Y) {
+					water++
+				}
+			}
+			maxWater := c.cfg.Fortifications.MaxBridgeWallLength
+			if water == 0 || maxWater <= 0 || water <= maxWater {
+				gap := &wallGap{path: [2]image.Point{run[0], run[len(run)-1]}, edge: e}
+				for _, p := range run {
+					if p == e.Path[0] || p == e.Path[1] {
+						v := p
+						gap.vertex = &v
+					}
+				}
+				gaps = append(gaps, gap)
+			}
+			run = []image.Point{}
+		}
+		for _, p := range pnts {
+			if wallable(p) && !c.cmap.isFortification(p.X, p.Y) {
+				run = append(run, p)
+			} else {
+				flush()
+			}
+		}
+		flush()
+	}
+
+	// the ends of edges should meet other edges, if they don't (and another
+	// loose end is near by) then the edges didn't quite line up
+	loose := []image.Point{}
+	for p, count := range ends {
+		if count == 1 && !c.onBorder(p) {
+			loose = append(loose, p)
+		}
+	}
+	sort.SliceStable(loose, func(i, k int) bool {
+		if loose[i].Y == loose[k].Y {
+			return loose[i].X < loose[k].X
+		}
+		return loose[i].Y < loose[k].Y
+	})
+	joined := map[image.Point]bool{}
+	for i, a := range loose {
+		if joined[a] {
+			continue
+		}
+		best, bestDist := -1, float64(width*2+2)
+		for k, b := range loose[i+1:] {
+			if joined[b] {
+				continue
+			}
+			if d := calculateDist(a.X, a.Y, b.X, b.Y); d <= bestDist {
+				best, bestDist = i+1+k, d
+			}
+		}
+		if best < 0 {
+			continue
+		}
+		b := loose[best]
+		joined[a], joined[b] = true, true
+		v := image.Pt((a.X+b.X)/2, (a.Y+b.Y)/2)
+		gaps = append(gaps, &wallGap{path: [2]image.Point{a, b}, vertex: &v})
+	}
+
+	return gaps
+}
@@ -0,0 +1,197 @@
+package citygraph
+
+import (
+	"image"
+	"math"
+	"sort"
+
+	"github.com/voidshard/citygraph/internal/cell"
+)
+
+// WallRing is a single wall (the city wall, an inner ring or a curtain wall)
+// given as an ordered ring of vertices with the towers & gates along it.
+// See Citygraph.WallRings
+type WallRing struct {
+	// vertices of the wall in order, running clockwise (as seen on the map).
+	// The last vertex joins back up with the first.
+	Vertices []image.Point
+
+	// indexes of vertices where the stretch on to the next vertex isn't walled,
+	// which is where this wall runs up against another (ie. a curtain wall)
+	Open []int `json:",omitempty"`
+
+	// IDs of the districts within the wall
+	Districts []int
+
+	// 0 for the main city wall (or curtain walls), otherwise the index+1 of
+	// the inner ring (see FortificationSettings.Rings)
+	Ring int `json:",omitempty"`
+
+	// towers & gates in order around the wall (from Vertices[0])
+	Towers []image.Rectangle `json:",omitempty"`
+	Gates  []*WallGate       `json:",omitempty"`
+}
+
+// WallGate describes a gate in a WallRing
+type WallGate struct {
+	Gatehouse image.Rectangle
+	Towers    []image.Rectangle `json:",omitempty"`
+
+	// the middle of the opening in the wall
+	Front image.Point
+
+	// the districts within & outside of the gate
+	Inside  int
+	Outside int
+
+	// the direction the gate faces (out of the wall) in degrees clockwise
+	// from north (up the map)
+	Facing float64
+
+	// IDs of the roads passing through the gate, if any (see RoadNetwork)
+	Roads []int `json:",omitempty"`
+}
+
+// wallRings orders the wall (as returned by cell.Circut, plus any pieces we
+// added to join up edges, see wallGaps) into rings & places the towers & gates
+// we built along it in order
+func wallRings(wall [][2]image.Point, in []*District, towers []image.Rectangle, gates map[string]*gateLocation, ring int) []*WallRing {
+	districts := []int{}
+	for _, d := range in {
+		districts = append(districts, d.ID)
+	}
+
+	rings := []*WallRing{}
+	for _, r := range cell.Rings(wall) {
+		rings = append(rings, &WallRing{
+			Vertices:  r.Vertices,
+			Open:      r.Open,
+			Districts: districts,
+			Ring:      ring,
+			Towers:    []image.Rectangle{},
+			Gates:     []*WallGate{},
+		})
+	}
+	if len(rings) == 0 {
+		return rings
+	}
+
+	// towers are placed on the ring nearest them, by how far around it they are
+	towerAt := map[*WallRing][]float64{}
+	for _, t := range towers {
+		tc := image.Pt((t.Min.X+t.Max.X)/2, (t.Min.Y+t.Max.Y)/2)
+		r, along := nearestRing(rings, tc)
+		r.Towers = append(r.Towers, t)
+		towerAt[r] = append(towerAt[r], along)
+	}
+
+	gateAt := map[*WallRing][]float64{}
+	for _, g := range gates {
+		r, along := nearestRing(rings, g.mid())
+		r.Gates = append(r.Gates, newWallGate(g))
+		gateAt[r] = append(gateAt[r], along)
+	}
+
+	for _, r := range rings {
+		sort.Sort(&byAlong{along: towerAt[r], swap: func(i, k int) { r.Towers[i], r.Towers[k] = r.Towers[k], r.Towers[i] }})
+		sort.Sort(&byAlong{along: gateAt[r], swap: func(i, k int) { r.Gates[i], r.Gates[k] = r.Gates[k], r.Gates[i] }})
+	}
+
+	return rings
+}
+
+// nearestRing returns the ring with a wall nearest to p & how far around the
+// ring p is, given as the index of the nearest wall plus how far along it
+func nearestRing(rings []*WallRing, p image.Point) (*WallRing, float64) {
+	var best *WallRing
+	bestDist, bestAlong := math.Inf(1), 0.0
+	for _, r := range rings {
+		for i := range r.Vertices {
+			a, b := r.Vertices[i], r.Vertices[(i+1)%len(r.Vertices)]
+			if d := distToSegment(p, a, b); d < bestDist {
+				best, bestDist = r, d
+				bestAlong = float64(i) + math.Max(0, math.Min(1, projection(a, b, p)))
+			}
+		}
+	}
+	return best, bestAlong
+}
+
+// byAlong sorts things by how far around a ring they are (see nearestRing)
+type byAlong struct {
+	along []float64
+	swap  func(i, k int)
+}
+
+func (b *byAlong) Len() int           { return len(b.along) }
+func (b *byAlong) Less(i, k int) bool { return b.along[i] < b.along[k] }
+func (b *byAlong) Swap(i, k int) {
+	b.along[i], b.along[k] = b.along[k], b.along[i]
+	b.swap(i, k)
+}
+
+// newWallGate returns the public description of the gate
+func newWallGate(g *gateLocation) *WallGate {
+	front := image.Pt((g.Left.X+g.Right.X)/2, (g.Left.Y+g.Right.Y)/2)
+
+	// the gatehouse is indented into the "In" site, so outward is from the
+	// gatehouse toward the edge
+	gc := image.Pt((g.Gatehouse.Min.X+g.Gatehouse.Max.X)/2, (g.Gatehouse.Min.Y+g.Gatehouse.Max.Y)/2)
+	mid := g.mid()
+	facing := math.Atan2(float64(mid.X-gc.X), float64(gc.Y-mid.Y)) * 180 / math.Pi
+	if facing < 0 {
+		facing += 360
+	}
+
+	return &WallGate{
+		Gatehouse: g.Gatehouse,
+		Towers:    g.Towers,
+		Front:     front,
+		Inside:    g.InDist.ID,
+		Outside:   g.OutDist.ID,
+		Facing:    facing,
+		Roads:     []int{},
+	}
+}
+
+// addGateRoads records the roads that pass through each gate of each wall.
+// Must be called once the RoadNetwork is linked.
+func (c *Citygraph) addGateRoads() {
+	rings := append([]*WallRing{}, c.WallRings...)
+	for _, d := range c.Districts {
+		rings = append(rings, d.WallRings...)
+	}
+
+	for _, r := range rings {
+		for _, g := range r.Gates {
+			for _, road := range c.RoadNetwork.Roads {
+				if g.passes(road) {
+					g.Roads = append(g.Roads, road.ID)
+				}
+			}
+		}
+	}
+}
+
+// passes returns if the road runs through the gatehouse. Roads stop short of
+// the gatehouse itself, so we look for a road heading in (or out) through the
+// gate that ends near it (rather than, say, a road running along the wall).
+func (g *WallGate) passes(r *Road) bool {
+	gc := image.Pt((g.Gatehouse.Min.X+g.Gatehouse.Max.X)/2, (g.Gatehouse.Min.Y+g.Gatehouse.Max.Y)/2)
+	reach := float64(maxint(g.Gatehouse.Dx(), g.Gatehouse.Dy()))/2 + 2
+
+	rad := g.Facing * math.Pi / 180
+	fx, fy := math.Sin(rad), -math.Cos(rad)
+	for _, s := range r.Sections {
+		for _, l := range s.lines() {
+			ux, uy, length := unitVector(l[0], l[1])
+			if length == 0 || math.Abs(ux*fx+uy*fy) < 0.9 {
+				continue
+			}
+			if distToSegment(gc, l[0], l[1]) <= reach {
+				return true
+			}
+		}
+	}
+	return false
+}
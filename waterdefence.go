@@ -0,0 +1,391 @@
+package citygraph
+
+import (
+	"image"
+	"math"
+
+	"github.com/voidshard/citygraph/internal/line"
+)
+
+// WaterCrossing determines how a wall is closed where it crosses too much
+// water (see FortificationSettings.WaterCrossing)
+type WaterCrossing string
+
+const (
+	OpenWater     WaterCrossing = ""        // the wall is left open (default)
+	SeaWalls      WaterCrossing = "seawall" // the wall runs along the shore instead
+	HarbourChains WaterCrossing = "chain"   // a chain is hung across the water between towers
+)
+
+// WaterDefenceKind is the kind of a WaterDefence
+type WaterDefenceKind string
+
+const (
+	SeaWallDefence   WaterDefenceKind = "seawall"   // a wall along the shore
+	ChainDefence     WaterDefenceKind = "chain"     // a chain (or boom) across the water between two towers
+	WaterGateDefence WaterDefenceKind = "watergate" // walls out into the water with a chain across the gap between them
+)
+
+// WaterDefence closes off water where the wall would otherwise be left open
+// (see Citygraph.WaterDefences)
+type WaterDefence struct {
+	Kind WaterDefenceKind
+
+	// the vertices of the sea wall along the shore, or the line the wall
+	// would have taken across the water (for chains & water gates)
+	Path []image.Point
+
+	// the chain(s) hung across the water, each between two towers
+	Chains [][2]image.Point `json:",omitempty"`
+
+	Towers []image.Rectangle `json:",omitempty"`
+}
+
+// waterCrossing is a stretch of wall we didn't build because it crosses too
+// much water (see MaxBridgeWallLength)
+type waterCrossing struct {
+	// the line of the wall across the water
+	path []image.Point
+
+	// the nearest land to either end, if any
+	landed [2]*image.Point
+}
+
+// waterCrossings joins the stretches of wall we didn't build over water
+// (as returned by lineSegments) end to end, so that each crossing runs from
+// shore to shore (or off into the water, where the wall does)
+func (c *Citygraph) waterCrossings(spans [][2]image.Point, reach int) []*waterCrossing {
+	near := func(a, b image.Point) bool {
+		return absint(a.X-b.X) <= 2 && absint(a.Y-b.Y) <= 2
+	}
+
+	crossings := []*waterCrossing{}
+	used := make([]bool, len(spans))
+	for i := range spans {
+		if used[i] {
+			continue
+		}
+		used[i] = true
+
+		path := []image.Point{spans[i][0], spans[i][1]}
+		for grown := true; grown; {
+			grown = false
+			for k, s := range spans {
+				if used[k] {
+					continue
+				}
+				head, tail := path[0], path[len(path)-1]
+				switch {
+				case near(tail, s[0]):
+					path = append(path, s[1])
+				case near(tail, s[1]):
+					path = append(path, s[0])
+				case near(head, s[1]):
+					path = append([]image.Point{s[0]}, path...)
+				case near(head, s[0]):
+					path = append([]image.Point{s[1]}, path...)
+				default:
+					continue
+				}
+				used[k], grown = true, true
+			}
+		}
+
+		x := &waterCrossing{path: path}
+		x.landed[0] = c.landing(path[0], reach)
+		x.landed[1] = c.landing(path[len(path)-1], reach)
+		crossings = append(crossings, x)
+	}
+
+	return crossings
+}
+
+// landing returns the nearest land (within reach) to p, if any. Failing that
+// we'll settle for a tower (or the like) that stands in the water.
+func (c *Citygraph) landing(p image.Point, reach int) *image.Point {
+	var land, fort *image.Point
+	landDist, fortDist := math.Inf(1), math.Inf(1)
+	for dy := -reach; dy <= reach; dy++ {
+		for dx := -reach; dx <= reach; dx++ {
+			q := image.Pt(p.X+dx, p.Y+dy)
+			if !q.In(c.cfg.Area) {
+				continue
+			}
+			d := math.Hypot(float64(dx), float64(dy))
+			if c.outline.CanBuildOn(q.X, q.Y) && d < landDist {
+				land, landDist = &q, d
+			} else if c.cmap.isFortification(q.X, q.Y) && d < fortDist {
+				fort, fortDist = &q, d
+			}
+		}
+	}
+	if land != nil {
+		return land
+	}
+	return fort
+}
+
+// defendWater closes the given water crossings according to
+// FortificationSettings.WaterCrossing, where `inside` holds the IDs of the
+// sites within the wall. Towers are placed with `tower` (which returns the
+// tower, if it fits) & along stretches of wall with `fill`.
+// Crossings that run off into the water are left open.
+func (c *Citygraph) defendWater(crossings []*waterCrossing, inside map[int]bool, width int, tower func(p image.Point, area image.Rectangle) *image.Rectangle, fill func(a, b image.Point) []image.Rectangle) []*WaterDefence {
+	defences := []*WaterDefence{}
+
+	mode := c.cfg.Fortifications.WaterCrossing
+	if mode != SeaWalls && mode != HarbourChains {
+		return defences
+	}
+
+	// the wall along each stretch of shore, returning the towers placed along it
+	buildWall := func(path []image.Point) []image.Rectangle {
+		towers := []image.Rectangle{}
+		for i := 1; i < len(path); i++ {
+			for _, l := range orthogonalise(path[i-1], path[i], c.cfg.RoadMode) {
+				c.cmap.drawWall(l[0], l[1], width)
+				towers = append(towers, fill(l[0], l[1])...)
+			}
+		}
+		return towers
+	}
+
+	walled := map[*waterCrossing]bool{}
+	if mode == SeaWalls {
+		for _, sw := range c.seaWalls(crossings, inside, float64(width)/2+1) {
+			walled[sw.from], walled[sw.to] = true, true
+			defences = append(defences, &WaterDefence{
+				Kind:   SeaWallDefence,
+				Path:   sw.path,
+				Towers: buildWall(sw.path),
+			})
+		}
+	}
+
+	// anything we couldn't wall along the shore (ie. the far bank of a river
+	// isn't within the wall) we chain across instead
+	for _, x := range crossings {
+		if walled[x] || x.landed[0] == nil || x.landed[1] == nil {
+			continue
+		}
+
+		a, b := x.path[0], x.path[len(x.path)-1]
+		maxChain := float64(c.cfg.Fortifications.MaxChainLength)
+		length := polylineLength(x.path)
+		if maxChain <= 0 || length <= maxChain {
+			d := &WaterDefence{Kind: ChainDefence, Path: x.path, Chains: [][2]image.Point{{a, b}}, Towers: []image.Rectangle{}}
+			for _, p := range []image.Point{a, b} {
+				if t := tower(p, c.cfg.Fortifications.TowerArea); t != nil {
+					d.Towers = append(d.Towers, *t)
+				}
+			}
+			c.addChain(a, b)
+			defences = append(defences, d)
+			continue
+		}
+
+		// too far to chain, so we build walls (moles) out into the water from
+		// either shore & chain the gap between them
+		gap := (length - maxChain) / 2
+		moles := [][]image.Point{cutPolyline(x.path, 0, gap), cutPolyline(x.path, gap+maxChain, length)}
+		ga, gb := moles[0][len(moles[0])-1], moles[1][0]
+
+		d := &WaterDefence{Kind: WaterGateDefence, Path: x.path, Chains: [][2]image.Point{{ga, gb}}, Towers: []image.Rectangle{}}
+		for _, p := range []image.Point{ga, gb} {
+			if t := tower(p, c.gateTowerArea()); t != nil {
+				d.Towers = append(d.Towers, *t)
+			}
+		}
+		for _, mole := range moles {
+			d.Towers = append(d.Towers, buildWall(mole)...)
+		}
+		c.addChain(ga, gb)
+		defences = append(defences, d)
+	}
+
+	return defences
+}
+
+// seaWall is a wall along the shore between the ends of two water crossings
+type seaWall struct {
+	from, to *waterCrossing
+	path     []image.Point
+}
+
+// seaWalls pairs up the ends of the water crossings with the nearest other
+// end along the shore (keeping within the sites `inside` the wall) & returns
+// the walls along the shore between them, simplified to within tolerance
+func (c *Citygraph) seaWalls(crossings []*waterCrossing, inside map[int]bool, tolerance float64) []*seaWall {
+	type end struct {
+		x *waterCrossing
+		p image.Point
+	}
+	ends := []*end{}
+	for _, x := range crossings {
+		for _, p := range x.landed {
+			// nb. the shore is land, not a tower out in the water
+			if p != nil && c.outline.CanBuildOn(p.X, p.Y) {
+				ends = append(ends, &end{x: x, p: *p})
+			}
+		}
+	}
+
+	shore := func(p image.Point) bool {
+		if !p.In(c.cfg.Area) || !c.outline.CanBuildOn(p.X, p.Y) {
+			return false
+		}
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				q := image.Pt(p.X+dx, p.Y+dy)
+				if q.In(c.cfg.Area) && !c.outline.CanBuildOn(q.X, q.Y) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	walls := []*seaWall{}
+	paired := map[*end]bool{}
+	for _, from := range ends {
+		if paired[from] {
+			continue
+		}
+		targets := map[image.Point]*end{}
+		for _, to := range ends {
+			if to != from && !paired[to] {
+				targets[to.p] = to
+			}
+		}
+
+		// breadth first along the shore until we find another end
+		prev := map[image.Point]image.Point{from.p: from.p}
+		queue := []image.Point{from.p}
+		var found *end
+		for len(queue) > 0 && found == nil {
+			p := queue[0]
+			queue = queue[1:]
+			for dy := -1; dy <= 1 && found == nil; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					q := image.Pt(p.X+dx, p.Y+dy)
+					if _, seen := prev[q]; seen {
+						continue
+					}
+					to, isTarget := targets[q]
+					if !isTarget && (!shore(q) || !inside[c.graph.SiteFor(q.X, q.Y).ID()]) {
+						continue
+					}
+					prev[q] = p
+					if isTarget {
+						found = to
+						break
+					}
+					queue = append(queue, q)
+				}
+			}
+		}
+		if found == nil {
+			continue
+		}
+		paired[from], paired[found] = true, true
+
+		path := []image.Point{found.p}
+		for p := found.p; p != from.p; {
+			p = prev[p]
+			path = append(path, p)
+		}
+		walls = append(walls, &seaWall{from: from.x, to: found.x, path: simplifyPath(path, tolerance)})
+	}
+
+	return walls
+}
+
+// addChain hangs a chain across the water between a & b. Roads can't cross it.
+func (c *Citygraph) addChain(a, b image.Point) {
+	for _, p := range line.PointsBetween(a, b) {
+		if !p.In(c.cfg.Area) || c.outline.CanBuildOn(p.X, p.Y) || c.cmap.isProtected(p.X, p.Y) {
+			continue
+		}
+		c.cmap.markArea(image.Rect(p.X, p.Y, p.X+1, p.Y+1), featureChain)
+		c.cmap.protect(p.X, p.Y)
+	}
+}
+
+// nearChain returns if there is a chain at (or next to) p
+func (c *Citygraph) nearChain(p image.Point) bool {
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			if c.cmap.hasFeature(p.X+dx, p.Y+dy, featureChain) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// polylineLength returns the length of the path
+func polylineLength(path []image.Point) float64 {
+	length := 0.0
+	for i := 1; i < len(path); i++ {
+		length += calculateDist(path[i-1].X, path[i-1].Y, path[i].X, path[i].Y)
+	}
+	return length
+}
+
+// cutPolyline returns the part of the path between `from` and `to` pixels
+// along it
+func cutPolyline(path []image.Point, from, to float64) []image.Point {
+	at := func(a, b image.Point, t float64) image.Point {
+		return image.Pt(
+			a.X+int(math.Round(t*float64(b.X-a.X))),
+			a.Y+int(math.Round(t*float64(b.Y-a.Y))),
+		)
+	}
+
+	cut := []image.Point{}
+	walked := 0.0
+	for i := 1; i < len(path); i++ {
+		a, b := path[i-1], path[i]
+		l := calculateDist(a.X, a.Y, b.X, b.Y)
+		if l == 0 {
+			continue
+		}
+		if len(cut) == 0 && walked+l >= from {
+			cut = append(cut, at(a, b, (from-walked)/l))
+		}
+		if len(cut) > 0 {
+			if walked+l >= to {
+				return append(cut, at(a, b, (to-walked)/l))
+			}
+			cut = append(cut, b)
+		}
+		walked += l
+	}
+	if len(cut) == 0 {
+		cut = append(cut, path[len(path)-1])
+	}
+	return cut
+}
+
+// simplifyPath drops vertices from the path where doing so keeps it within
+// tolerance pixels of where it was (Ramer-Douglas-Peucker)
+func simplifyPath(path []image.Point, tolerance float64) []image.Point {
+	if len(path) < 3 {
+		return path
+	}
+	first, last := path[0], path[len(path)-1]
+
+	worst, worstDist := 0, 0.0
+	for i := 1; i < len(path)-1; i++ {
+		if d := distToSegment(path[i], first, last); d > worstDist {
+			worst, worstDist = i, d
+		}
+	}
+	if worstDist <= tolerance {
+		return []image.Point{first, last}
+	}
+
+	left := simplifyPath(path[:worst+1], tolerance)
+	right := simplifyPath(path[worst:], tolerance)
+	return append(append([]image.Point{}, left[:len(left)-1]...), right...)
+}
@@ -0,0 +1,90 @@
+package citygraph
+
+import (
+	"image"
+	"reflect"
+	"testing"
+)
+
+func TestCutPolyline(t *testing.T) {
+	corner := []image.Point{{0, 0}, {10, 0}, {10, 10}}
+
+	cases := []struct {
+		name     string
+		path     []image.Point
+		from, to float64
+		expect   []image.Point
+	}{
+		{"within a segment", corner, 2, 5, []image.Point{{2, 0}, {5, 0}}},
+		{"around a corner", corner, 5, 15, []image.Point{{5, 0}, {10, 0}, {10, 5}}},
+		{"whole path", corner, 0, 20, []image.Point{{0, 0}, {10, 0}, {10, 10}}},
+		{"to past the end", corner, 5, 100, []image.Point{{5, 0}, {10, 0}, {10, 10}}},
+		{"from past the end", corner, 50, 100, []image.Point{{10, 10}}},
+		{"zero length segment", []image.Point{{0, 0}, {0, 0}, {10, 0}}, 0, 10, []image.Point{{0, 0}, {10, 0}}},
+		{"single point", []image.Point{{3, 3}}, 0, 10, []image.Point{{3, 3}}},
+	}
+	for _, tc := range cases {
+		got := cutPolyline(tc.path, tc.from, tc.to)
+		if !reflect.DeepEqual(got, tc.expect) {
+			t.Errorf("%s: expected %v got %v", tc.name, tc.expect, got)
+		}
+	}
+}
+
+func TestSimplifyPath(t *testing.T) {
+	cases := []struct {
+		name      string
+		path      []image.Point
+		tolerance float64
+		expect    []image.Point
+	}{
+		{
+			"too short",
+			[]image.Point{{0, 0}, {4, 7}},
+			1,
+			[]image.Point{{0, 0}, {4, 7}},
+		},
+		{
+			"collinear merged",
+			[]image.Point{{0, 0}, {5, 0}, {10, 0}},
+			0,
+			[]image.Point{{0, 0}, {10, 0}},
+		},
+		{
+			"corner kept",
+			[]image.Point{{0, 0}, {10, 0}, {10, 10}},
+			1,
+			[]image.Point{{0, 0}, {10, 0}, {10, 10}},
+		},
+		{
+			"collinear merged either side of a corner",
+			[]image.Point{{0, 0}, {3, 0}, {6, 0}, {6, 5}, {6, 10}},
+			0,
+			[]image.Point{{0, 0}, {6, 0}, {6, 10}},
+		},
+		{
+			"within tolerance",
+			[]image.Point{{0, 0}, {5, 1}, {10, 0}},
+			2,
+			[]image.Point{{0, 0}, {10, 0}},
+		},
+		{
+			"outside tolerance",
+			[]image.Point{{0, 0}, {5, 1}, {10, 0}},
+			0.5,
+			[]image.Point{{0, 0}, {5, 1}, {10, 0}},
+		},
+		{
+			"zero length",
+			[]image.Point{{2, 2}, {2, 2}, {2, 2}},
+			1,
+			[]image.Point{{2, 2}, {2, 2}},
+		},
+	}
+	for _, tc := range cases {
+		got := simplifyPath(tc.path, tc.tolerance)
+		if !reflect.DeepEqual(got, tc.expect) {
+			t.Errorf("%s: expected %v got %v", tc.name, tc.expect, got)
+		}
+	}
+}